@@ -46,10 +46,13 @@ func installCommonConfigFlags(conf *config.Config, flags *pflag.FlagSet) {
 
 	flags.IntVar(&conf.Mtu, "mtu", 0, "Set the containers network MTU")
 	flags.BoolVar(&conf.RawLogs, "raw-logs", false, "Full timestamps without ANSI coloring")
+	flags.BoolVar(&conf.CaseInsensitiveRefs, "case-insensitive-references", false, "Retry failed image lookups with the reference lowercased")
+	flags.Int64Var(&conf.CopyVolumeSizeLimit, "volume-copy-size-limit", 0, "Skip copying image data into new volumes beyond this many bytes (0 = no limit)")
 	flags.Var(opts.NewListOptsRef(&conf.DNS, opts.ValidateIPAddress), "dns", "DNS server to use")
 	flags.Var(opts.NewNamedListOptsRef("dns-opts", &conf.DNSOptions, nil), "dns-opt", "DNS options to use")
 	flags.Var(opts.NewListOptsRef(&conf.DNSSearch, opts.ValidateDNSSearch), "dns-search", "DNS search domains to use")
 	flags.Var(opts.NewNamedListOptsRef("labels", &conf.Labels, opts.ValidateLabel), "label", "Set key=value labels to the daemon")
+	flags.Var(opts.NewNamedListOptsRef("hook-envs", &conf.HookEnv, opts.ValidateEnv), "hook-env", "Environment variables to pass to container hooks")
 	flags.StringVar(&conf.LogConfig.Type, "log-driver", "json-file", "Default driver for container logs")
 	flags.Var(opts.NewNamedMapOpts("log-opts", conf.LogConfig.Config, nil), "log-opt", "Default log driver options for containers")
 	flags.StringVar(&conf.ClusterAdvertise, "cluster-advertise", "", "Address or interface name to advertise")
@@ -86,10 +89,19 @@ func installRegistryServiceFlags(options *registry.ServiceOptions, flags *pflag.
 	ana := opts.NewNamedListOptsRef("allow-nondistributable-artifacts", &options.AllowNondistributableArtifacts, registry.ValidateIndexName)
 	mirrors := opts.NewNamedListOptsRef("registry-mirrors", &options.Mirrors, registry.ValidateMirror)
 	insecureRegistries := opts.NewNamedListOptsRef("insecure-registries", &options.InsecureRegistries, registry.ValidateIndexName)
+	pushConfirmRegistries := opts.NewNamedListOptsRef("push-confirm-registries", &options.PushConfirmRegistries, registry.ValidateIndexName)
+	blockedRegistries := opts.NewNamedListOptsRef("blocked-registries", &options.BlockedRegistries, registry.ValidateIndexName)
+	allowedRegistries := opts.NewNamedListOptsRef("allowed-registries", &options.AllowedRegistries, registry.ValidateIndexName)
+	readOnlyRegistries := opts.NewNamedListOptsRef("read-only-registries", &options.ReadOnlyRegistries, registry.ValidateIndexName)
 
 	flags.Var(ana, "allow-nondistributable-artifacts", "Allow push of nondistributable artifacts to registry")
 	flags.Var(mirrors, "registry-mirror", "Preferred Docker registry mirror")
 	flags.Var(insecureRegistries, "insecure-registry", "Enable insecure registry communication")
+	flags.Var(pushConfirmRegistries, "push-confirm-registry", "Require explicit confirmation for pushes to registry")
+	flags.Var(blockedRegistries, "block-registry", "Refuse to contact registry for pulls and pushes")
+	flags.Var(allowedRegistries, "allow-registry", "Allow contacting only the listed registries")
+	flags.Var(readOnlyRegistries, "registry-readonly", "Allow pulls from but refuse pushes to registry")
+	flags.BoolVar(&options.RequireFullyQualifiedNames, "require-fully-qualified-names", false, "Reject image references that do not specify a registry")
 
 	if runtime.GOOS != "windows" {
 		// TODO: Remove this flag after 3 release cycles (18.03)
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -56,6 +57,12 @@ var (
 	errInvalidNetwork  = errors.New("invalid network settings while building port map info")
 )
 
+// CopyVolumeSizeLimit caps the amount of image data copied into a freshly
+// created volume. When the source tree is larger, the copy is skipped with a
+// warning instead of blocking container start. Zero means no limit. It is
+// set once from the daemon configuration before containers are started.
+var CopyVolumeSizeLimit int64
+
 // ExitStatus provides exit reasons for a container.
 type ExitStatus struct {
 	// The exit code with which the container exited.
@@ -457,14 +464,21 @@ func (container *Container) AddMountPointWithVolume(destination string, vol volu
 	}
 }
 
-// UnmountVolumes unmounts all volumes
+// UnmountVolumes unmounts all volumes. Mounts are set up in ascending order
+// of their destination's path depth, so they are taken down deepest first:
+// a nested mount like /data/logs must go before its parent /data.
 func (container *Container) UnmountVolumes(volumeEventLog func(name, action string, attributes map[string]string)) error {
 	var errors []string
+	mountPoints := make([]*volume.MountPoint, 0, len(container.MountPoints))
 	for _, volumeMount := range container.MountPoints {
 		if volumeMount.Volume == nil {
 			continue
 		}
+		mountPoints = append(mountPoints, volumeMount)
+	}
+	sort.Sort(sort.Reverse(mountPointsByDepth(mountPoints)))
 
+	for _, volumeMount := range mountPoints {
 		if err := volumeMount.Cleanup(); err != nil {
 			errors = append(errors, err.Error())
 			continue
@@ -482,6 +496,21 @@ func (container *Container) UnmountVolumes(volumeEventLog func(name, action stri
 	return nil
 }
 
+// mountPointsByDepth sorts mount points by the number of parts in their
+// destination (a/b/c would be 3 parts), the same ordering the daemon mounts
+// them in.
+type mountPointsByDepth []*volume.MountPoint
+
+func (m mountPointsByDepth) Len() int      { return len(m) }
+func (m mountPointsByDepth) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m mountPointsByDepth) Less(i, j int) bool {
+	return m.parts(i) < m.parts(j)
+}
+
+func (m mountPointsByDepth) parts(i int) int {
+	return strings.Count(filepath.Clean(m[i].Destination), string(os.PathSeparator))
+}
+
 // IsDestinationMounted checks whether a path is mounted on the container or not.
 func (container *Container) IsDestinationMounted(destination string) bool {
 	return container.MountPoints[destination] != nil
@@ -2,11 +2,13 @@ package container
 
 import (
 	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/docker/docker/api/types/container"
 	swarmtypes "github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/pkg/signal"
+	"github.com/docker/docker/volume"
 )
 
 func TestContainerStopSignal(t *testing.T) {
@@ -66,3 +68,19 @@ func TestContainerSecretReferenceDestTarget(t *testing.T) {
 		t.Fatalf("expected secret dest %q; received %q", expected, d)
 	}
 }
+
+func TestMountPointsByDepth(t *testing.T) {
+	mountPoints := []*volume.MountPoint{
+		{Destination: "/data/logs"},
+		{Destination: "/data"},
+		{Destination: "/data/logs/archive"},
+	}
+	sort.Sort(sort.Reverse(mountPointsByDepth(mountPoints)))
+
+	expected := []string{"/data/logs/archive", "/data/logs", "/data"}
+	for i, destination := range expected {
+		if mountPoints[i].Destination != destination {
+			t.Fatalf("expected %s at position %d, got %s", destination, i, mountPoints[i].Destination)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	containertypes "github.com/docker/docker/api/types/container"
 	mounttypes "github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/pkg/chrootarchive"
+	"github.com/docker/docker/pkg/directory"
 	"github.com/docker/docker/pkg/mount"
 	"github.com/docker/docker/pkg/stringid"
 	"github.com/docker/docker/pkg/system"
@@ -146,7 +147,16 @@ func (container *Container) CopyImagePathContent(v volume.Volume, destination st
 	if err := label.Relabel(path, container.MountLabel, true); err != nil && err != unix.ENOTSUP {
 		return err
 	}
-	return copyExistingContents(rootfs, path)
+	if err := copyExistingContents(rootfs, path); err != nil {
+		return err
+	}
+	// The copy carries the xattrs of the image files with it, including
+	// their SELinux contexts; relabel the tree again so the copied files
+	// get the container's mount label like the volume itself.
+	if err := label.Relabel(path, container.MountLabel, true); err != nil && err != unix.ENOTSUP {
+		return err
+	}
+	return nil
 }
 
 // ShmResourcePath returns path to shm
@@ -396,6 +406,16 @@ func copyExistingContents(source, destination string) error {
 			return err
 		}
 		if len(srcList) == 0 {
+			if CopyVolumeSizeLimit > 0 {
+				size, err := directory.Size(source)
+				if err != nil {
+					return err
+				}
+				if size > CopyVolumeSizeLimit {
+					logrus.Warnf("not copying the %d bytes of existing contents of %s into the volume: larger than the %d byte copy limit", size, source, CopyVolumeSizeLimit)
+					return copyOwnership(source, destination)
+				}
+			}
 			// If the source volume is empty, copies files from the root into the volume
 			if err := chrootarchive.NewArchiver(nil).CopyWithTar(source, destination); err != nil {
 				return err
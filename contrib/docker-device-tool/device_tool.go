@@ -153,7 +153,7 @@ func main() {
 			usage()
 		}
 
-		err := devices.MountDevice(args[1], args[2], "")
+		err := devices.MountDevice(args[1], args[2], "", false)
 		if err != nil {
 			fmt.Println("Can't mount device: ", err)
 			os.Exit(1)
@@ -88,7 +88,9 @@ type CommonConfig struct {
 	AuthzMiddleware       *authorization.Middleware `json:"-"`
 	AuthorizationPlugins  []string                  `json:"authorization-plugins,omitempty"` // AuthorizationPlugins holds list of authorization plugins
 	AutoRestart           bool                      `json:"-"`
+	CaseInsensitiveRefs   bool                      `json:"case-insensitive-references,omitempty"` // CaseInsensitiveRefs retries failed image lookups with the reference lowercased
 	Context               map[string][]string       `json:"-"`
+	CopyVolumeSizeLimit   int64                     `json:"volume-copy-size-limit,omitempty"` // CopyVolumeSizeLimit skips copying image data into new volumes beyond this many bytes, 0 means no limit
 	DisableBridge         bool                      `json:"-"`
 	DNS                   []string                  `json:"dns,omitempty"`
 	DNSOptions            []string                  `json:"dns-opts,omitempty"`
@@ -96,6 +98,7 @@ type CommonConfig struct {
 	ExecOptions           []string                  `json:"exec-opts,omitempty"`
 	GraphDriver           string                    `json:"storage-driver,omitempty"`
 	GraphOptions          []string                  `json:"storage-opts,omitempty"`
+	HookEnv               []string                  `json:"hook-envs,omitempty"` // HookEnv holds extra environment variables passed to container hooks
 	Labels                []string                  `json:"labels,omitempty"`
 	Mtu                   int                       `json:"mtu,omitempty"`
 	NetworkDiagnosticPort int                       `json:"network-diagnostic-port,omitempty"`
@@ -593,6 +593,9 @@ func NewDaemon(config *config.Config, registryService registry.Service, containe
 	// Do we have a disabled network?
 	config.DisableBridge = isBridgeNetworkDisabled(config)
 
+	// Cap the image data copied into freshly created volumes, if requested.
+	container.CopyVolumeSizeLimit = config.CopyVolumeSizeLimit
+
 	// Verify the platform is supported as a daemon
 	if !platformSupported {
 		return nil, errSystemNotSupported
@@ -241,8 +241,10 @@ func getBlkioThrottleDevices(devs []*blkiodev.ThrottleDevice) ([]specs.LinuxThro
 			return nil, err
 		}
 		d := specs.LinuxThrottleDevice{Rate: d.Rate}
-		d.Major = int64(stat.Rdev / 256)
-		d.Minor = int64(stat.Rdev % 256)
+		// the rdev of a device is not the linear major*256+minor encoding
+		// for high device numbers, so use the proper macros
+		d.Major = int64(unix.Major(stat.Rdev))
+		d.Minor = int64(unix.Minor(stat.Rdev))
 		throttleDevices = append(throttleDevices, d)
 	}
 
@@ -414,6 +416,10 @@ func verifyContainerResources(resources *containertypes.Resources, sysInfo *sysi
 		}
 		resources.OomKillDisable = nil
 	}
+	if resources.OomKillDisable != nil && *resources.OomKillDisable && resources.Memory == 0 {
+		warnings = append(warnings, "OOM killer is disabled for the container, but no memory limit is set, this can result in the system running out of resources.")
+		logrus.Warn("OOM killer is disabled for the container, but no memory limit is set, this can result in the system running out of resources.")
+	}
 
 	if resources.PidsLimit != 0 && !sysInfo.PidsLimit {
 		warnings = append(warnings, "Your kernel does not support pids limit capabilities or the cgroup is not mounted. PIDs limit discarded.")
@@ -740,6 +746,11 @@ func verifyDaemonSettings(conf *config.Config) error {
 	if err := VerifyCgroupDriver(conf); err != nil {
 		return err
 	}
+	// Surface all unmounted cgroup subsystems in one message rather than
+	// leaving the user to collect them from individual warnings.
+	if err := sysinfo.CheckCgroupSubsystems(); err != nil {
+		logrus.Warn(err)
+	}
 	if conf.CgroupParent != "" && UsingSystemd(conf) {
 		if len(conf.CgroupParent) <= 6 || !strings.HasSuffix(conf.CgroupParent, ".slice") {
 			return fmt.Errorf("cgroup-parent for systemd cgroup should be a valid slice named as \"xxx.slice\"")
@@ -1,3 +1,4 @@
+//go:build !windows
 // +build !windows
 
 package daemon
@@ -7,12 +8,15 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/docker/docker/api/types/blkiodev"
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/container"
 	"github.com/docker/docker/daemon/config"
 	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/sysinfo"
 	"github.com/docker/docker/volume"
 	"github.com/docker/docker/volume/drivers"
 	"github.com/docker/docker/volume/local"
@@ -355,3 +359,104 @@ func TestMigratePre17Volumes(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyContainerResourcesMemorySwappiness(t *testing.T) {
+	si := sysinfo.New(true)
+	if !si.MemorySwappiness {
+		t.Skip("cgroup memory swappiness not supported")
+	}
+
+	swappiness := func(v int64) *int64 { return &v }
+
+	// -1 means inherit from the parent and is normalized away; 0 and 100
+	// are the valid boundaries.
+	for _, valid := range []*int64{nil, swappiness(-1), swappiness(0), swappiness(50), swappiness(100)} {
+		resources := &containertypes.Resources{MemorySwappiness: valid}
+		if _, err := verifyContainerResources(resources, si, false); err != nil {
+			t.Errorf("expected swappiness %v to be accepted: %v", valid, err)
+		}
+	}
+
+	for _, invalid := range []*int64{swappiness(-2), swappiness(101)} {
+		resources := &containertypes.Resources{MemorySwappiness: invalid}
+		if _, err := verifyContainerResources(resources, si, false); err == nil {
+			t.Errorf("expected swappiness %d to be rejected", *invalid)
+		}
+	}
+}
+
+func TestVerifyContainerResourcesOomKillDisable(t *testing.T) {
+	si := sysinfo.New(true)
+	if !si.OomKillDisable {
+		t.Skip("cgroup oom kill disable not supported")
+	}
+
+	oomKillDisable := true
+
+	// Disabling the OOM killer without a memory limit risks wedging the
+	// whole host, so it must produce a warning.
+	resources := &containertypes.Resources{OomKillDisable: &oomKillDisable}
+	warnings, err := verifyContainerResources(resources, si, false)
+	require.NoError(t, err)
+	found := false
+	for _, w := range warnings {
+		if strings.Contains(w, "OOM killer is disabled") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a warning about disabling the OOM killer without a memory limit, got %v", warnings)
+	}
+
+	// With a memory limit set there is nothing to warn about.
+	resources = &containertypes.Resources{OomKillDisable: &oomKillDisable, Memory: 16 * 1024 * 1024}
+	warnings, err = verifyContainerResources(resources, si, false)
+	require.NoError(t, err)
+	for _, w := range warnings {
+		if strings.Contains(w, "OOM killer is disabled") {
+			t.Errorf("unexpected warning: %s", w)
+		}
+	}
+}
+
+func TestVerifyContainerResourcesKernelMemory(t *testing.T) {
+	si := sysinfo.New(true)
+	if !si.KernelMemory {
+		t.Skip("cgroup kernel memory not supported")
+	}
+
+	// Limits below the 4MB minimum must be rejected; anything at or above
+	// it is passed through to the OCI spec.
+	resources := &containertypes.Resources{KernelMemory: 2 * 1024 * 1024}
+	if _, err := verifyContainerResources(resources, si, false); err == nil {
+		t.Error("expected a kernel memory limit below 4MB to be rejected")
+	}
+
+	resources = &containertypes.Resources{KernelMemory: 4 * 1024 * 1024}
+	if _, err := verifyContainerResources(resources, si, false); err != nil {
+		t.Errorf("expected a 4MB kernel memory limit to be accepted: %v", err)
+	}
+}
+
+func TestGetBlkioThrottleDevices(t *testing.T) {
+	if _, err := os.Stat("/dev/null"); err != nil {
+		t.Skip("/dev/null not available")
+	}
+
+	devs := []*blkiodev.ThrottleDevice{{Path: "/dev/null", Rate: 1024}}
+	throttleDevices, err := getBlkioThrottleDevices(devs)
+	require.NoError(t, err)
+	require.Len(t, throttleDevices, 1)
+	// /dev/null is always char device 1:3
+	if throttleDevices[0].Major != 1 || throttleDevices[0].Minor != 3 {
+		t.Errorf("expected /dev/null to resolve to 1:3, got %d:%d", throttleDevices[0].Major, throttleDevices[0].Minor)
+	}
+	if throttleDevices[0].Rate != 1024 {
+		t.Errorf("expected rate 1024, got %d", throttleDevices[0].Rate)
+	}
+
+	devs = []*blkiodev.ThrottleDevice{{Path: "/dev/does-not-exist", Rate: 1024}}
+	if _, err := getBlkioThrottleDevices(devs); err == nil {
+		t.Error("expected an error for a nonexistent device path")
+	}
+}
@@ -4,6 +4,8 @@ package devmapper
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +15,8 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -42,6 +46,10 @@ var (
 	defaultUdevSyncOverride             = false
 	maxDeviceID                         = 0xffffff // 24 bit, pool limit
 	deviceIDMapSz                       = (maxDeviceID + 1) / 8
+	maxFreeDeviceIDs                    = 1024 // bound on the recently-freed device ID list
+	discardWorkers                      = 2    // background goroutines serving dm.async_discard
+	discardQueueSize                    = 100  // queued discards before deletion falls back to synchronous
+	defaultLowWatermarkPercent   uint32 = 90   // usage percentage above which Status raises a warning
 	driverDeferredRemovalSupport        = false
 	enableDeferredRemoval               = false
 	enableDeferredDeletion              = false
@@ -52,6 +60,16 @@ var (
 
 const deviceSetMetaFile string = "deviceset-metadata"
 const transactionMetaFile string = "transaction-metadata"
+const resizeMetaFile string = "resize-in-progress"
+
+// deviceSetSchemaVersion is the current schema version of the persisted
+// deviceset metadata. Files carrying an older version are upgraded one
+// step at a time by the schemaMigrations table when loaded.
+const deviceSetSchemaVersion = 1
+
+// deferredRemovalProbeHash is the hash of the throwaway device used to
+// verify that deferred removal actually works.
+const deferredRemovalProbeHash = "probe-deferred-removal"
 
 type transaction struct {
 	OpenTransactionID uint64 `json:"open_transaction_id"`
@@ -66,7 +84,12 @@ type devInfo struct {
 	TransactionID uint64 `json:"transaction_id"`
 	Initialized   bool   `json:"initialized"`
 	Deleted       bool   `json:"deleted"`
-	devices       *DeviceSet
+
+	// ExternalOrigin is the path of the read-only block device this thin
+	// device was snapshotted from, if it did not originate in the pool.
+	ExternalOrigin string `json:"external_origin,omitempty"`
+
+	devices *DeviceSet
 
 	// The global DeviceSet lock guarantees that we serialize all
 	// the calls to libdevmapper (which is not threadsafe), but we
@@ -94,34 +117,112 @@ type DeviceSet struct {
 	TransactionID uint64 `json:"-"`
 	NextDeviceID  int    `json:"next_device_id"`
 	deviceIDMap   []byte
+	freeDeviceIDs []int // recently freed IDs, tried before scanning deviceIDMap
 
 	// Options
-	dataLoopbackSize      int64
-	metaDataLoopbackSize  int64
-	baseFsSize            uint64
-	filesystem            string
-	mountOptions          string
-	mkfsArgs              []string
-	dataDevice            string // block or loop dev
-	dataLoopFile          string // loopback file, if used
-	metadataDevice        string // block or loop dev
-	metadataLoopFile      string // loopback file, if used
-	doBlkDiscard          bool
-	thinpBlockSize        uint32
-	thinPoolDevice        string
-	transaction           `json:"-"`
-	overrideUdevSyncCheck bool
-	deferredRemove        bool   // use deferred removal
-	deferredDelete        bool   // use deferred deletion
-	BaseDeviceUUID        string // save UUID of base device
-	BaseDeviceFilesystem  string // save filesystem of base device
-	nrDeletedDevices      uint   // number of deleted devices
-	deletionWorkerTicker  *time.Ticker
-	uidMaps               []idtools.IDMap
-	gidMaps               []idtools.IDMap
-	minFreeSpacePercent   uint32 //min free space percentage in thinpool
-	xfsNospaceRetries     string // max retries when xfs receives ENOSPC
-	lvmSetupConfig        directLVMConfig
+	dataLoopbackSize         int64
+	metaDataLoopbackSize     int64
+	baseFsSize               uint64
+	filesystem               string
+	mountOptions             string
+	mkfsArgs                 []string
+	dataDevice               string // block or loop dev
+	dataLoopFile             string // loopback file, if used
+	metadataDevice           string // block or loop dev
+	metadataLoopFile         string // loopback file, if used
+	doBlkDiscard             bool
+	thinpBlockSize           uint32
+	thinPoolDevice           string
+	transaction              `json:"-"`
+	overrideUdevSyncCheck    bool
+	deferredRemove           bool   // use deferred removal
+	deferredDelete           bool   // use deferred deletion
+	BaseDeviceUUID           string // save UUID of base device
+	BaseDeviceFilesystem     string // save filesystem of base device
+	SchemaVersion            int    `json:"schema_version"` // version of the persisted metadata format
+	nrDeletedDevices         uint   // number of deleted devices
+	deletionWorkerTicker     *time.Ticker
+	uidMaps                  []idtools.IDMap
+	gidMaps                  []idtools.IDMap
+	minFreeSpacePercent      uint32 //min free space percentage in thinpool
+	xfsNospaceRetries        string // max retries when xfs receives ENOSPC
+	lvmSetupConfig           directLVMConfig
+	pool                     poolManager
+	metadataBackupDir        string // secondary location for the deviceset metadata, if configured
+	syncer                   fileSyncer
+	skipDeferredRemovalProbe bool // skip the startup deferred-removal self-check
+	errorIfNoSpace           bool // make the pool error I/O instead of queueing when full
+	repairMetadata           bool // run thin_check/thin_repair before creating the pool
+	runTool                  toolRunner
+	mkfsTimeout              time.Duration // kill mkfs if it runs longer than this, 0 disables
+	dump                     dumpRunner
+	xfsQuota                 bool // cap xfs devices with a project quota at mount
+	asyncDiscard             bool // queue discards to background workers on delete
+	discardJobs              chan *devInfo
+	discardWG                sync.WaitGroup
+}
+
+// fileSyncer flushes a path to stable storage. It is a DeviceSet field so
+// tests can observe which paths are synced without touching real storage.
+type fileSyncer func(path string) error
+
+// dumpRunner invokes an external tool, streaming its stdout to w. It is
+// a DeviceSet field so tests can substitute it.
+type dumpRunner func(w io.Writer, name string, args ...string) error
+
+func runDumpCommand(w io.Writer, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("devmapper: %s failed: %s: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// toolRunner invokes an external tool. It is a DeviceSet field so tests can
+// mock out thin_check/thin_repair.
+type toolRunner func(name string, args ...string) error
+
+func runToolCommand(name string, args ...string) error {
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("devmapper: %s %v failed: %v (output: %q)", name, args, err, string(out))
+	}
+	return nil
+}
+
+func fsyncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// poolManager abstracts the libdevmapper pool operations used by the
+// transaction logic, so the metadata/transaction state machine can be
+// exercised in tests without root privileges or a real thin pool.
+type poolManager interface {
+	SetTransactionID(poolName string, oldID, newID uint64) error
+	CreateDevice(poolName string, deviceID int) error
+	DeleteDevice(poolName string, deviceID int) error
+}
+
+// devicemapperPool routes pool operations to libdevmapper.
+type devicemapperPool struct{}
+
+func (devicemapperPool) SetTransactionID(poolName string, oldID, newID uint64) error {
+	return devicemapper.SetTransactionID(poolName, oldID, newID)
+}
+
+func (devicemapperPool) CreateDevice(poolName string, deviceID int) error {
+	return devicemapper.CreateDevice(poolName, deviceID)
+}
+
+func (devicemapperPool) DeleteDevice(poolName string, deviceID int) error {
+	return devicemapper.DeleteDevice(poolName, deviceID)
 }
 
 // DiskUsage contains information about disk usage and is used when reporting Status of a device.
@@ -168,6 +269,15 @@ type Status struct {
 	DeferredDeleteEnabled      bool
 	DeferredDeletedDeviceCount uint
 	MinFreeSpace               uint64
+	// MetadataNeedsCheck is true when the kernel has flagged the pool
+	// metadata as suspect; the operator should run thin_check.
+	MetadataNeedsCheck bool
+	// DataLowWatermark is true when data usage has crossed the low-space
+	// watermark and the pool should be grown soon.
+	DataLowWatermark bool
+	// MetadataLowWatermark is the same warning for metadata usage, a
+	// common silent failure on thin pools.
+	MetadataLowWatermark bool
 }
 
 // Structure used to export image/container metadata in docker inspect.
@@ -175,6 +285,7 @@ type deviceMetadata struct {
 	deviceID   int
 	deviceSize uint64 // size in bytes
 	deviceName string // Device name as used during activation
+	deviceUsed uint64 // bytes actually mapped in the pool, 0 when inactive
 }
 
 // DevStatus returns information about device mounted containing its id, size and sector information.
@@ -191,6 +302,11 @@ type DevStatus struct {
 	MappedSectors uint64
 	// HighestMappedSector is the pointer to the highest mapped sector.
 	HighestMappedSector uint64
+	// AllocatedBytes is the number of bytes actually allocated to the
+	// device in the pool, as opposed to its provisioned Size.
+	AllocatedBytes uint64
+	// BlockSize is the pool block size in bytes.
+	BlockSize uint64
 }
 
 func getDevName(name string) string {
@@ -233,6 +349,15 @@ func (devices *DeviceSet) deviceSetMetaFile() string {
 	return path.Join(devices.metadataDir(), deviceSetMetaFile)
 }
 
+// deviceSetMetaBackupFile returns the secondary location of the deviceset
+// metadata, or "" if no backup directory was configured.
+func (devices *DeviceSet) deviceSetMetaBackupFile() string {
+	if devices.metadataBackupDir == "" {
+		return ""
+	}
+	return path.Join(devices.metadataBackupDir, deviceSetMetaFile)
+}
+
 func (devices *DeviceSet) oldMetadataFile() string {
 	return path.Join(devices.loopbackDir(), "json")
 }
@@ -309,7 +434,7 @@ func (devices *DeviceSet) allocateTransactionID() uint64 {
 }
 
 func (devices *DeviceSet) updatePoolTransactionID() error {
-	if err := devicemapper.SetTransactionID(devices.getPoolDevName(), devices.TransactionID, devices.OpenTransactionID); err != nil {
+	if err := devices.pool.SetTransactionID(devices.getPoolDevName(), devices.TransactionID, devices.OpenTransactionID); err != nil {
 		return fmt.Errorf("devmapper: Error setting devmapper transaction ID: %s", err)
 	}
 	devices.TransactionID = devices.OpenTransactionID
@@ -325,7 +450,9 @@ func (devices *DeviceSet) removeMetadata(info *devInfo) error {
 
 // Given json data and file path, write it to disk
 func (devices *DeviceSet) writeMetaFile(jsonData []byte, filePath string) error {
-	tmpFile, err := ioutil.TempFile(devices.metadataDir(), ".tmp")
+	// The temporary file must live in the target directory so the final
+	// rename is atomic; the backup directory may be on separate storage.
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), ".tmp")
 	if err != nil {
 		return fmt.Errorf("devmapper: Error creating metadata file: %s", err)
 	}
@@ -370,6 +497,12 @@ func (devices *DeviceSet) markDeviceIDFree(deviceID int) {
 	i := deviceID % 8
 	mask = ^(1 << uint(i))
 	devices.deviceIDMap[deviceID/8] = devices.deviceIDMap[deviceID/8] & mask
+
+	// Remember recently freed IDs so the next allocation can skip the
+	// linear bitmap scan.
+	if len(devices.freeDeviceIDs) < maxFreeDeviceIDs {
+		devices.freeDeviceIDs = append(devices.freeDeviceIDs, deviceID)
+	}
 }
 
 func (devices *DeviceSet) isDeviceIDFree(deviceID int) bool {
@@ -412,6 +545,129 @@ func (devices *DeviceSet) constructDeviceIDMap() {
 	}
 }
 
+// reconcileDeviceIDMap cross-checks the device ID bitmap against the loaded
+// device metadata. A crash between markDeviceIDUsed and saveMetadata can
+// leave a bit set with no backing device, permanently leaking the ID; such
+// bits are freed. Conversely, metadata whose ID is not marked used would let
+// the same ID be handed out twice, so those bits are set. Both cases are
+// logged since they indicate an earlier unclean shutdown or a bug.
+// Should be called with devices.Lock() held.
+func (devices *DeviceSet) reconcileDeviceIDMap() {
+	used := make(map[int]struct{}, len(devices.Devices))
+	for _, info := range devices.Devices {
+		used[info.DeviceID] = struct{}{}
+	}
+
+	// Scan byte-wise so the all-zero stretches of the map are skipped
+	// quickly.
+	for i, b := range devices.deviceIDMap {
+		if b == 0 {
+			continue
+		}
+		for j := 0; j < 8; j++ {
+			if b&(1<<uint(j)) == 0 {
+				continue
+			}
+			deviceID := i*8 + j
+			if _, ok := used[deviceID]; !ok {
+				logrus.Warnf("devmapper: Device ID %d is marked used but has no metadata; freeing leaked ID", deviceID)
+				devices.markDeviceIDFree(deviceID)
+			}
+		}
+	}
+
+	for _, info := range devices.Devices {
+		if devices.isDeviceIDFree(info.DeviceID) {
+			logrus.Warnf("devmapper: Device %s uses ID %d which is not marked used; marking it", info.Hash, info.DeviceID)
+			devices.markDeviceIDUsed(info.DeviceID)
+		}
+	}
+}
+
+// Verify audits the loaded device metadata without mutating anything,
+// returning the hashes (including the base device "") that look
+// inconsistent: a device ID shared by two entries, an ID out of range, or
+// a device registered under a transaction the pool never committed. Thin
+// devices are only visible to libdevmapper while active, so pool
+// membership cannot be probed without activating every device; the audit
+// cross-checks the metadata against itself and the pool transaction ID
+// instead. An admin can feed the result to Repair once all containers
+// are stopped.
+func (devices *DeviceSet) Verify() ([]string, error) {
+	devices.Lock()
+	defer devices.Unlock()
+
+	// Scan in a stable order so repeated runs report identically.
+	hashes := make([]string, 0, len(devices.Devices))
+	for hash := range devices.Devices {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	var bad []string
+	byID := make(map[int]string, len(devices.Devices))
+	for _, hash := range hashes {
+		info := devices.Devices[hash]
+
+		if info.DeviceID < 0 || info.DeviceID > maxDeviceID {
+			logrus.Warnf("devmapper: Device %q has out of range device ID %d", hash, info.DeviceID)
+			bad = append(bad, hash)
+			continue
+		}
+
+		if first, ok := byID[info.DeviceID]; ok {
+			logrus.Warnf("devmapper: Device %q shares device ID %d with %q", hash, info.DeviceID, first)
+			bad = append(bad, hash)
+			continue
+		}
+		byID[info.DeviceID] = hash
+
+		if info.TransactionID > devices.TransactionID {
+			logrus.Warnf("devmapper: Device %q belongs to transaction %d which the pool (at %d) never committed", hash, info.TransactionID, devices.TransactionID)
+			bad = append(bad, hash)
+		}
+	}
+
+	return bad, nil
+}
+
+// Repair removes the metadata of the devices reported by Verify and
+// rebuilds the device-ID bitmap, so repeated crashes that leak IDs do not
+// eventually end in "Unable to find a free device ID". It refuses to run
+// while any of the candidate devices is active, since a mounted container
+// could still be using it. Every action taken is logged.
+func (devices *DeviceSet) Repair(hashes []string) error {
+	devices.Lock()
+	defer devices.Unlock()
+
+	for _, hash := range hashes {
+		info := devices.Devices[hash]
+		if info == nil {
+			return fmt.Errorf("devmapper: Unknown device %s", hash)
+		}
+		if devinfo, _ := devicemapper.GetInfo(info.Name()); devinfo != nil && devinfo.Exists != 0 {
+			return fmt.Errorf("devmapper: Device %s is active, stop its container before repairing", hash)
+		}
+	}
+
+	for _, hash := range hashes {
+		info := devices.Devices[hash]
+		logrus.Infof("devmapper: Repair: removing metadata of device %q (device ID %d)", hash, info.DeviceID)
+		if err := devices.unregisterDevice(hash); err != nil {
+			return err
+		}
+	}
+
+	// Rebuild the ID bitmap from the surviving devices rather than
+	// freeing IDs one by one: with duplicate IDs the surviving entry must
+	// keep its bit set.
+	logrus.Info("devmapper: Repair: rebuilding device ID bitmap")
+	devices.deviceIDMap = make([]byte, deviceIDMapSz)
+	devices.constructDeviceIDMap()
+
+	return devices.saveDeviceSetMetaData()
+}
+
 func (devices *DeviceSet) deviceFileWalkFunction(path string, finfo os.FileInfo) error {
 
 	// Skip some of the meta files which are not device files.
@@ -435,6 +691,11 @@ func (devices *DeviceSet) deviceFileWalkFunction(path string, finfo os.FileInfo)
 		return nil
 	}
 
+	if finfo.Name() == resizeMetaFile {
+		logrus.Debugf("devmapper: Skipping file %s", path)
+		return nil
+	}
+
 	logrus.Debugf("devmapper: Loading data for file %s", path)
 
 	hash := finfo.Name()
@@ -529,6 +790,9 @@ func (devices *DeviceSet) activateDeviceIfNeeded(info *devInfo, ignoreDeleted bo
 		return nil
 	}
 
+	if info.ExternalOrigin != "" {
+		return devicemapper.ActivateDeviceWithExternal(devices.getPoolDevName(), info.Name(), info.DeviceID, info.Size, info.ExternalOrigin)
+	}
 	return devicemapper.ActivateDevice(devices.getPoolDevName(), info.Name(), info.DeviceID, info.Size)
 }
 
@@ -583,6 +847,36 @@ func mkfsOptions(fs string) []string {
 	return []string{}
 }
 
+// blockCountRegexp matches a bare mkfs.ext4 blocks-count argument, optionally
+// carrying a multiplier suffix.
+var blockCountRegexp = regexp.MustCompile(`^[0-9]+[kKmMgGtT]?$`)
+
+// validateMkfsArgs rejects mkfs arguments that override the filesystem size.
+// The filesystem is always created to span the thin device, whose size comes
+// from dm.basesize; a conflicting size in dm.mkfsarg can leave the filesystem
+// larger than the device and corrupt it.
+func validateMkfsArgs(args []string) error {
+	prev := ""
+	for _, arg := range args {
+		for _, field := range strings.Fields(arg) {
+			switch {
+			case prev == "-d" && strings.HasPrefix(field, "size="):
+				// mkfs.xfs -d size=N
+				return fmt.Errorf("devmapper: dm.mkfsarg %q sets the filesystem size; use dm.basesize instead", arg)
+			case strings.HasPrefix(field, "-dsize="):
+				return fmt.Errorf("devmapper: dm.mkfsarg %q sets the filesystem size; use dm.basesize instead", arg)
+			case !strings.HasPrefix(prev, "-") && blockCountRegexp.MatchString(field):
+				// mkfs.ext4 takes the filesystem size as a bare
+				// blocks-count argument; a number that is not the
+				// value of a preceding option can only be that.
+				return fmt.Errorf("devmapper: dm.mkfsarg %q looks like a filesystem size; use dm.basesize instead", arg)
+			}
+			prev = field
+		}
+	}
+	return nil
+}
+
 func (devices *DeviceSet) createFilesystem(info *devInfo) (err error) {
 	devname := info.DevName()
 
@@ -608,22 +902,45 @@ func (devices *DeviceSet) createFilesystem(info *devInfo) (err error) {
 
 	switch devices.filesystem {
 	case "xfs":
-		err = exec.Command("mkfs.xfs", args...).Run()
+		err = devices.runMkfsCommand("mkfs.xfs", args...)
 	case "ext4":
-		err = exec.Command("mkfs.ext4", append([]string{"-E", "nodiscard,lazy_itable_init=0,lazy_journal_init=0"}, args...)...).Run()
+		err = devices.runMkfsCommand("mkfs.ext4", append([]string{"-E", "nodiscard,lazy_itable_init=0,lazy_journal_init=0"}, args...)...)
 		if err != nil {
-			err = exec.Command("mkfs.ext4", append([]string{"-E", "nodiscard,lazy_itable_init=0"}, args...)...).Run()
+			err = devices.runMkfsCommand("mkfs.ext4", append([]string{"-E", "nodiscard,lazy_itable_init=0"}, args...)...)
 		}
 		if err != nil {
 			return err
 		}
-		err = exec.Command("tune2fs", append([]string{"-c", "-1", "-i", "0"}, devname)...).Run()
+		err = devices.runMkfsCommand("tune2fs", append([]string{"-c", "-1", "-i", "0"}, devname)...)
 	default:
 		err = fmt.Errorf("devmapper: Unsupported filesystem type %s", devices.filesystem)
 	}
 	return
 }
 
+// runMkfsCommand runs a filesystem creation command, killing it when it
+// exceeds the configured dm.mkfs_timeout (a hung mkfs on a slow loopback
+// file would otherwise wedge base image setup forever). Failures carry
+// the combined output, since mkfs reports the interesting details on
+// stderr.
+func (devices *DeviceSet) runMkfsCommand(name string, args ...string) error {
+	ctx := context.Background()
+	if devices.mkfsTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, devices.mkfsTimeout)
+		defer cancel()
+	}
+
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("devmapper: %s timed out after %v, the underlying device may be unresponsive", name, devices.mkfsTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("devmapper: %s failed: %s: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
 func (devices *DeviceSet) migrateOldMetaData() error {
 	// Migrate old metadata file
 	jsonData, err := ioutil.ReadFile(devices.oldMetadataFile())
@@ -715,7 +1032,7 @@ func (devices *DeviceSet) initMetaData() error {
 		return err
 	}
 
-	_, transactionID, _, _, _, _, err := devices.poolStatus()
+	_, transactionID, _, _, _, _, _, err := devices.poolStatus()
 	if err != nil {
 		return err
 	}
@@ -727,6 +1044,7 @@ func (devices *DeviceSet) initMetaData() error {
 	}
 
 	devices.constructDeviceIDMap()
+	devices.reconcileDeviceIDMap()
 	devices.countDeletedDevices()
 
 	if err := devices.processPendingTransaction(); err != nil {
@@ -744,6 +1062,19 @@ func (devices *DeviceSet) incNextDeviceID() {
 }
 
 func (devices *DeviceSet) getNextFreeDeviceID() (int, error) {
+	// Prefer recently freed IDs over scanning the bitmap, which gets slow
+	// on densely packed pools. Entries can be stale — the bitmap may have
+	// been rebuilt since they were recorded — so each is revalidated.
+	for len(devices.freeDeviceIDs) > 0 {
+		n := len(devices.freeDeviceIDs) - 1
+		deviceID := devices.freeDeviceIDs[n]
+		devices.freeDeviceIDs = devices.freeDeviceIDs[:n]
+		if devices.isDeviceIDFree(deviceID) {
+			devices.markDeviceIDUsed(deviceID)
+			return deviceID, nil
+		}
+	}
+
 	devices.incNextDeviceID()
 	for i := 0; i <= maxDeviceID; i++ {
 		if devices.isDeviceIDFree(devices.NextDeviceID) {
@@ -761,7 +1092,7 @@ func (devices *DeviceSet) poolHasFreeSpace() error {
 		return nil
 	}
 
-	_, _, dataUsed, dataTotal, metadataUsed, metadataTotal, err := devices.poolStatus()
+	_, _, dataUsed, dataTotal, metadataUsed, metadataTotal, _, err := devices.poolStatus()
 	if err != nil {
 		return err
 	}
@@ -792,6 +1123,12 @@ func (devices *DeviceSet) createRegisterDevice(hash string) (*devInfo, error) {
 	devices.Lock()
 	defer devices.Unlock()
 
+	// Refuse to eat into the configured free-space reserve, like
+	// takeSnapshot does for snapshot devices.
+	if err := devices.poolHasFreeSpace(); err != nil {
+		return nil, err
+	}
+
 	deviceID, err := devices.getNextFreeDeviceID()
 	if err != nil {
 		return nil, err
@@ -804,7 +1141,7 @@ func (devices *DeviceSet) createRegisterDevice(hash string) (*devInfo, error) {
 	}
 
 	for {
-		if err := devicemapper.CreateDevice(devices.getPoolDevName(), deviceID); err != nil {
+		if err := devices.pool.CreateDevice(devices.getPoolDevName(), deviceID); err != nil {
 			if devicemapper.DeviceIDExists(err) {
 				// Device ID already exists. This should not
 				// happen. Now we have a mechanism to find
@@ -843,6 +1180,76 @@ func (devices *DeviceSet) createRegisterDevice(hash string) (*devInfo, error) {
 	return info, nil
 }
 
+// createRegisterExternalSnapshot allocates and registers a thin device
+// whose content comes from an external read-only origin device. The thin
+// device itself is created empty in the pool; the origin is attached at
+// activation time.
+func (devices *DeviceSet) createRegisterExternalSnapshot(hash, originDev string, size uint64) error {
+	if err := devices.poolHasFreeSpace(); err != nil {
+		return err
+	}
+
+	deviceID, err := devices.getNextFreeDeviceID()
+	if err != nil {
+		return err
+	}
+
+	if err := devices.openTransaction(hash, deviceID); err != nil {
+		logrus.Debugf("devmapper: Error opening transaction hash = %s deviceID = %d", hash, deviceID)
+		devices.markDeviceIDFree(deviceID)
+		return err
+	}
+
+	for {
+		if err := devices.pool.CreateDevice(devices.getPoolDevName(), deviceID); err != nil {
+			if devicemapper.DeviceIDExists(err) {
+				// Device ID already exists. This should not
+				// happen. Now we have a mechanism to find
+				// a free device ID. So something is not right.
+				// Give a warning and continue.
+				logrus.Errorf("devmapper: Device ID %d exists in pool but it is supposed to be unused", deviceID)
+				deviceID, err = devices.getNextFreeDeviceID()
+				if err != nil {
+					return err
+				}
+				// Save new device id into transaction
+				devices.refreshTransaction(deviceID)
+				continue
+			}
+			logrus.Debugf("devmapper: Error creating external snapshot device: %s", err)
+			devices.markDeviceIDFree(deviceID)
+			return err
+		}
+		break
+	}
+
+	info, err := devices.registerDevice(deviceID, hash, size, devices.OpenTransactionID)
+	if err != nil {
+		devices.pool.DeleteDevice(devices.getPoolDevName(), deviceID)
+		devices.markDeviceIDFree(deviceID)
+		logrus.Debugf("devmapper: Error registering device: %s", err)
+		return err
+	}
+
+	// Persist the external-origin marker so the device is activated with
+	// its origin after a daemon restart.
+	info.ExternalOrigin = originDev
+	if err := devices.saveMetadata(info); err != nil {
+		devices.unregisterDevice(hash)
+		devices.pool.DeleteDevice(devices.getPoolDevName(), deviceID)
+		devices.markDeviceIDFree(deviceID)
+		return err
+	}
+
+	if err := devices.closeTransaction(); err != nil {
+		devices.unregisterDevice(hash)
+		devices.pool.DeleteDevice(devices.getPoolDevName(), deviceID)
+		devices.markDeviceIDFree(deviceID)
+		return err
+	}
+	return nil
+}
+
 func (devices *DeviceSet) takeSnapshot(hash string, baseInfo *devInfo, size uint64) error {
 	var (
 		devinfo *devicemapper.Info
@@ -962,16 +1369,43 @@ func (devices *DeviceSet) loadMetadata(hash string) *devInfo {
 	return info
 }
 
+// blkid runs right after device activation, and on slow udev systems the
+// device node may not have settled yet, making blkid intermittently fail
+// or report an empty UUID. Retry a bounded number of times with a short
+// sleep before giving up.
+const deviceUUIDMaxRetries = 10
+const deviceUUIDRetryDelay = 100 * time.Millisecond
+
+// uuidCommand invokes blkid for the given device. It is a variable so
+// tests can stub out the external command.
+var uuidCommand = func(device string) ([]byte, error) {
+	return exec.Command("blkid", "-s", "UUID", "-o", "value", device).Output()
+}
+
 func getDeviceUUID(device string) (string, error) {
-	out, err := exec.Command("blkid", "-s", "UUID", "-o", "value", device).Output()
-	if err != nil {
-		return "", fmt.Errorf("devmapper: Failed to find uuid for device %s:%v", device, err)
+	var lastErr error
+	for i := 0; i < deviceUUIDMaxRetries; i++ {
+		if i > 0 {
+			time.Sleep(deviceUUIDRetryDelay)
+		}
+
+		out, err := uuidCommand(device)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		uuid := strings.TrimSuffix(string(out), "\n")
+		uuid = strings.TrimSpace(uuid)
+		if uuid == "" {
+			lastErr = fmt.Errorf("blkid reported an empty uuid")
+			continue
+		}
+		logrus.Debugf("devmapper: UUID for device: %s is:%s", device, uuid)
+		return uuid, nil
 	}
 
-	uuid := strings.TrimSuffix(string(out), "\n")
-	uuid = strings.TrimSpace(uuid)
-	logrus.Debugf("devmapper: UUID for device: %s is:%s", device, uuid)
-	return uuid, nil
+	return "", fmt.Errorf("devmapper: Failed to find uuid for device %s after %d attempts:%v", device, deviceUUIDMaxRetries, lastErr)
 }
 
 func (devices *DeviceSet) getBaseDeviceSize() uint64 {
@@ -1107,7 +1541,7 @@ func (devices *DeviceSet) thinPoolExists(thinPoolDevice string) (bool, error) {
 }
 
 func (devices *DeviceSet) checkThinPool() error {
-	_, transactionID, dataUsed, _, _, _, err := devices.poolStatus()
+	_, transactionID, dataUsed, _, _, _, _, err := devices.poolStatus()
 	if err != nil {
 		return err
 	}
@@ -1158,25 +1592,65 @@ func (devices *DeviceSet) checkGrowBaseDeviceFS(info *devInfo) error {
 	defer info.lock.Unlock()
 
 	devices.Lock()
-	defer devices.Unlock()
 
 	info.Size = devices.baseFsSize
 
 	if err := devices.saveMetadata(info); err != nil {
 		// Try to remove unused device
 		delete(devices.Devices, info.Hash)
+		devices.Unlock()
+		return err
+	}
+
+	devices.Unlock()
+
+	return devices.growFS(info)
+}
+
+// growDeviceFS grows an inactive device and its filesystem to the
+// configured base size, persisting the new size. Called with info.lock
+// held but without the global lock.
+func (devices *DeviceSet) growDeviceFS(info *devInfo) error {
+	devices.Lock()
+
+	// Only grow devices that are not already active: a running container
+	// keeps its current size until it is restarted, since the thin
+	// target size is fixed at activation time.
+	if devinfo, _ := devicemapper.GetInfo(info.Name()); devinfo != nil && devinfo.Exists != 0 {
+		devices.Unlock()
+		logrus.Debugf("devmapper: Skipping grow of active device %s", info.Hash)
+		return nil
+	}
+
+	logrus.Infof("devmapper: Growing device %s from %d to %d bytes", info.Hash, info.Size, devices.baseFsSize)
+	info.Size = devices.baseFsSize
+	if err := devices.saveMetadata(info); err != nil {
+		devices.Unlock()
 		return err
 	}
 
+	devices.Unlock()
+
 	return devices.growFS(info)
 }
 
+// growFS mounts the device and grows its filesystem to the device size.
+// Called with info.lock held, but without the global lock; the global lock
+// is only taken around device activation and deactivation, so the mount
+// and filesystem resize do not serialize unrelated device creation.
 func (devices *DeviceSet) growFS(info *devInfo) error {
-	if err := devices.activateDeviceIfNeeded(info, false); err != nil {
+	devices.Lock()
+	err := devices.activateDeviceIfNeeded(info, false)
+	devices.Unlock()
+	if err != nil {
 		return fmt.Errorf("Error activating devmapper device: %s", err)
 	}
 
-	defer devices.deactivateDevice(info)
+	defer func() {
+		devices.Lock()
+		devices.deactivateDevice(info)
+		devices.Unlock()
+	}()
 
 	fsMountPoint := "/run/docker/mnt"
 	if _, err := os.Stat(fsMountPoint); os.IsNotExist(err) {
@@ -1272,6 +1746,40 @@ func minor(device uint64) uint64 {
 }
 
 // ResizePool increases the size of the pool.
+func (devices *DeviceSet) resizeMetaFile() string {
+	return path.Join(devices.metadataDir(), resizeMetaFile)
+}
+
+// markResizeInProgress records that the pool is about to be suspended for
+// a resize, so an interrupted resize can be detected on the next start.
+func (devices *DeviceSet) markResizeInProgress() error {
+	return devices.writeMetaFile([]byte(devices.getPoolName()), devices.resizeMetaFile())
+}
+
+func (devices *DeviceSet) clearResizeInProgress() error {
+	if err := os.Remove(devices.resizeMetaFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// recoverInterruptedResize resumes the pool when a resize marker was left
+// behind, meaning a previous daemon died between suspending and resuming
+// the pool; a suspended pool hangs all container I/O.
+func (devices *DeviceSet) recoverInterruptedResize() {
+	if _, err := os.Stat(devices.resizeMetaFile()); err != nil {
+		return
+	}
+	logrus.Warnf("devmapper: Found an interrupted pool resize, resuming pool %s", devices.getPoolName())
+	if err := devicemapper.ResumeDevice(devices.getPoolName()); err != nil {
+		logrus.Errorf("devmapper: Unable to resume pool %s after interrupted resize: %s", devices.getPoolName(), err)
+		return
+	}
+	if err := devices.clearResizeInProgress(); err != nil {
+		logrus.Warnf("devmapper: Unable to clear resize marker: %s", err)
+	}
+}
+
 func (devices *DeviceSet) ResizePool(size int64) error {
 	dirname := devices.loopbackDir()
 	datafilename := path.Join(dirname, "data")
@@ -1326,13 +1834,19 @@ func (devices *DeviceSet) ResizePool(size int64) error {
 		return fmt.Errorf("Unable to update loopback capacity: %s", err)
 	}
 
+	// Record the resize before suspending, so a crash between suspend
+	// and resume can be detected and the pool resumed on the next start.
+	if err := devices.markResizeInProgress(); err != nil {
+		return fmt.Errorf("devmapper: Unable to record pool resize: %s", err)
+	}
+
 	// Suspend the pool
 	if err := devicemapper.SuspendDevice(devices.getPoolName()); err != nil {
 		return fmt.Errorf("devmapper: Unable to suspend pool: %s", err)
 	}
 
 	// Reload with the new block sizes
-	if err := devicemapper.ReloadPool(devices.getPoolName(), dataloopback, metadataloopback, devices.thinpBlockSize); err != nil {
+	if err := devicemapper.ReloadPoolWithFeatures(devices.getPoolName(), dataloopback, metadataloopback, devices.thinpBlockSize, devices.poolFeatures()); err != nil {
 		return fmt.Errorf("devmapper: Unable to reload pool: %s", err)
 	}
 
@@ -1341,6 +1855,10 @@ func (devices *DeviceSet) ResizePool(size int64) error {
 		return fmt.Errorf("devmapper: Unable to resume pool: %s", err)
 	}
 
+	if err := devices.clearResizeInProgress(); err != nil {
+		logrus.Warnf("devmapper: Unable to clear resize marker: %s", err)
+	}
+
 	return nil
 }
 
@@ -1379,7 +1897,7 @@ func (devices *DeviceSet) rollbackTransaction() error {
 	// A device id might have already been deleted before transaction
 	// closed. In that case this call will fail. Just leave a message
 	// in case of failure.
-	if err := devicemapper.DeleteDevice(devices.getPoolDevName(), devices.DeviceID); err != nil {
+	if err := devices.pool.DeleteDevice(devices.getPoolDevName(), devices.DeviceID); err != nil {
 		logrus.Errorf("devmapper: Unable to delete device: %s", err)
 	}
 
@@ -1425,18 +1943,79 @@ func (devices *DeviceSet) processPendingTransaction() error {
 	return nil
 }
 
+// schemaMigrations maps a schema version to the function that upgrades
+// the deviceset metadata to the next version. Version 0 is the historical
+// format without a version field.
+var schemaMigrations = map[int]func(*DeviceSet) error{
+	0: func(devices *DeviceSet) error {
+		// Version 1 only introduced the version field itself. The old
+		// all-in-one "json" device file predates the version field and
+		// is still handled separately by migrateOldMetaData.
+		return nil
+	},
+}
+
+// migrateDeviceSetMetaData upgrades freshly loaded deviceset metadata to
+// the current schema version one step at a time and writes the result
+// back, so a later version bump only needs a new schemaMigrations entry.
+func (devices *DeviceSet) migrateDeviceSetMetaData() error {
+	if devices.SchemaVersion == deviceSetSchemaVersion {
+		return nil
+	}
+	if devices.SchemaVersion > deviceSetSchemaVersion {
+		return fmt.Errorf("devmapper: deviceset metadata schema version %d is newer than supported version %d", devices.SchemaVersion, deviceSetSchemaVersion)
+	}
+
+	for devices.SchemaVersion < deviceSetSchemaVersion {
+		migrate, ok := schemaMigrations[devices.SchemaVersion]
+		if !ok {
+			return fmt.Errorf("devmapper: no migration from deviceset metadata schema version %d", devices.SchemaVersion)
+		}
+		logrus.Infof("devmapper: Migrating deviceset metadata from schema version %d to %d", devices.SchemaVersion, devices.SchemaVersion+1)
+		if err := migrate(devices); err != nil {
+			return err
+		}
+		devices.SchemaVersion++
+	}
+
+	return devices.saveDeviceSetMetaData()
+}
+
 func (devices *DeviceSet) loadDeviceSetMetaData() error {
 	jsonData, err := ioutil.ReadFile(devices.deviceSetMetaFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if jsonErr := json.Unmarshal(jsonData, devices); jsonErr == nil {
+			return devices.migrateDeviceSetMetaData()
+		} else if devices.deviceSetMetaBackupFile() == "" {
+			return jsonErr
+		}
+		logrus.Warnf("devmapper: Deviceset metadata %s is corrupt, falling back to backup", devices.deviceSetMetaFile())
+	}
+
+	// The primary is missing or corrupt; try the backup location if one
+	// was configured. For backward compatibility a missing primary with no
+	// backup is not an error.
+	backupFile := devices.deviceSetMetaBackupFile()
+	if backupFile == "" {
+		devices.SchemaVersion = deviceSetSchemaVersion
+		return nil
+	}
+	jsonData, err = ioutil.ReadFile(backupFile)
 	if err != nil {
-		// For backward compatibility return success if file does
-		// not exist.
 		if os.IsNotExist(err) {
+			devices.SchemaVersion = deviceSetSchemaVersion
 			return nil
 		}
 		return err
 	}
-
-	return json.Unmarshal(jsonData, devices)
+	logrus.Infof("devmapper: Restoring deviceset metadata from backup %s", backupFile)
+	if err := json.Unmarshal(jsonData, devices); err != nil {
+		return err
+	}
+	return devices.migrateDeviceSetMetaData()
 }
 
 func (devices *DeviceSet) saveDeviceSetMetaData() error {
@@ -1445,10 +2024,22 @@ func (devices *DeviceSet) saveDeviceSetMetaData() error {
 		return fmt.Errorf("devmapper: Error encoding metadata to json: %s", err)
 	}
 
-	return devices.writeMetaFile(jsonData, devices.deviceSetMetaFile())
-}
+	if err := devices.writeMetaFile(jsonData, devices.deviceSetMetaFile()); err != nil {
+		return err
+	}
 
-func (devices *DeviceSet) openTransaction(hash string, DeviceID int) error {
+	if backupFile := devices.deviceSetMetaBackupFile(); backupFile != "" {
+		if err := os.MkdirAll(devices.metadataBackupDir, 0700); err != nil {
+			return fmt.Errorf("devmapper: Error creating metadata backup directory: %s", err)
+		}
+		if err := devices.writeMetaFile(jsonData, backupFile); err != nil {
+			return fmt.Errorf("devmapper: Error writing deviceset metadata backup: %s", err)
+		}
+	}
+	return nil
+}
+
+func (devices *DeviceSet) openTransaction(hash string, DeviceID int) error {
 	devices.allocateTransactionID()
 	devices.DeviceIDHash = hash
 	devices.DeviceID = DeviceID
@@ -1742,6 +2333,12 @@ func (devices *DeviceSet) initDevmapper(doInit bool) (retErr error) {
 	// so we add this badhack to make sure it closes itself
 	setCloseOnExec("/dev/mapper/control")
 
+	// A crash during a pool resize leaves the pool suspended; resume it
+	// before anything touches it.
+	if poolExists {
+		devices.recoverInterruptedResize()
+	}
+
 	// Make sure the sparse images exist in <root>/devicemapper/data and
 	// <root>/devicemapper/metadata
 
@@ -1822,7 +2419,16 @@ func (devices *DeviceSet) initDevmapper(doInit bool) (retErr error) {
 		}
 		defer metadataFile.Close()
 
-		if err := devicemapper.CreatePool(devices.getPoolName(), dataFile, metadataFile, devices.thinpBlockSize); err != nil {
+		// With explicit opt-in, verify and if necessary repair the
+		// metadata before it backs a live pool. The pool is known not
+		// to be active here.
+		if devices.repairMetadata {
+			if err := devices.checkRepairMetadata(metadataFile.Name()); err != nil {
+				return err
+			}
+		}
+
+		if err := devicemapper.CreatePoolWithFeatures(devices.getPoolName(), dataFile, metadataFile, devices.thinpBlockSize, devices.poolFeatures()); err != nil {
 			return err
 		}
 		defer func() {
@@ -1874,9 +2480,130 @@ func (devices *DeviceSet) initDevmapper(doInit bool) (retErr error) {
 		}
 	}
 
+	// Warn loudly at startup when the kernel has flagged the pool
+	// metadata as suspect, so the operator can run thin_check before
+	// the pool degrades further.
+	if _, _, _, _, _, _, needsCheck, err := devices.poolStatus(); err == nil && needsCheck {
+		logrus.Warnf("devmapper: Thin pool %s metadata needs check. Run thin_check on the metadata device and repair it before continuing to use this pool", devices.getPoolName())
+	}
+
+	// Deferred removal support is detected from driver and library
+	// versions, but some kernels advertise it without honoring the
+	// request. Verify it end to end and fall back to synchronous
+	// removal when the probe fails.
+	if devices.deferredRemove && !devices.skipDeferredRemovalProbe {
+		if err := devices.probeDeferredRemoval(); err != nil {
+			logrus.Warnf("devmapper: Deferred removal does not work on this kernel, disabling it: %v", err)
+			devices.deferredRemove = false
+			devices.deferredDelete = false
+		}
+	}
+
 	return nil
 }
 
+// checkRepairMetadata runs thin_check against the metadata device and, if
+// it reports corruption, attempts thin_repair into a scratch file that is
+// then copied back over the device. This is destructive to corrupt
+// metadata and only runs with the dm.repair_metadata opt-in, before the
+// pool is activated.
+func (devices *DeviceSet) checkRepairMetadata(metadataDev string) error {
+	run := devices.runTool
+	if run == nil {
+		run = runToolCommand
+	}
+
+	err := run("thin_check", metadataDev)
+	if err == nil {
+		return nil
+	}
+	logrus.Warnf("devmapper: thin_check reported damaged metadata on %s, attempting thin_repair: %v", metadataDev, err)
+
+	repairFile := path.Join(devices.metadataDir(), "metadata.repair")
+	defer os.Remove(repairFile)
+	if err := run("thin_repair", "-i", metadataDev, "-o", repairFile); err != nil {
+		return fmt.Errorf("devmapper: Metadata repair failed, manual intervention required: %v", err)
+	}
+	if err := copyFileContent(repairFile, metadataDev); err != nil {
+		return fmt.Errorf("devmapper: Error writing repaired metadata back to %s: %s", metadataDev, err)
+	}
+
+	// The repaired metadata must pass a second check before we trust it.
+	if err := run("thin_check", metadataDev); err != nil {
+		return fmt.Errorf("devmapper: Metadata still damaged after thin_repair, manual intervention required: %v", err)
+	}
+	logrus.Warnf("devmapper: Metadata on %s was repaired with thin_repair", metadataDev)
+	return nil
+}
+
+func copyFileContent(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// poolFeatures returns the extra thin-pool feature arguments implied by
+// the configured storage options.
+func (devices *DeviceSet) poolFeatures() []string {
+	var features []string
+	if devices.errorIfNoSpace {
+		features = append(features, "error_if_no_space")
+	}
+	return features
+}
+
+// probeDeferredRemoval creates a throwaway device, issues a deferred
+// removal against it and confirms the kernel reports the deferred flag,
+// then cancels the removal and deletes the device again. Skippable with
+// the dm.skip_deferred_removal_probe storage option.
+func (devices *DeviceSet) probeDeferredRemoval() error {
+	logrus.Debug("devmapper: Probing deferred removal support")
+
+	info, err := devices.createRegisterDevice(deferredRemovalProbeHash)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := devices.DeleteDevice(deferredRemovalProbeHash, true); err != nil {
+			logrus.Debugf("devmapper: Error deleting deferred removal probe device: %v", err)
+		}
+	}()
+
+	info.lock.Lock()
+	defer info.lock.Unlock()
+
+	devices.Lock()
+	defer devices.Unlock()
+
+	if err := devices.activateDeviceIfNeeded(info, false); err != nil {
+		return err
+	}
+	if err := devicemapper.RemoveDeviceDeferred(info.Name()); err != nil {
+		return err
+	}
+	devinfo, err := devicemapper.GetInfoWithDeferred(info.Name())
+	if err != nil {
+		return err
+	}
+	if devinfo == nil || devinfo.DeferredRemove == 0 {
+		return fmt.Errorf("devmapper: kernel did not mark device %s for deferred removal", info.Name())
+	}
+	return devices.cancelDeferredRemoval(info)
+}
+
 // AddDevice adds a device and registers in the hash.
 func (devices *DeviceSet) AddDevice(hash, baseHash string, storageOpt map[string]string) error {
 	logrus.Debugf("devmapper: AddDevice START(hash=%s basehash=%s)", hash, baseHash)
@@ -1895,15 +2622,7 @@ func (devices *DeviceSet) AddDevice(hash, baseHash string, storageOpt map[string
 	baseInfo.lock.Lock()
 	defer baseInfo.lock.Unlock()
 
-	devices.Lock()
-	defer devices.Unlock()
-
-	// Also include deleted devices in case hash of new device is
-	// same as one of the deleted devices.
-	if info, _ := devices.lookupDevice(hash); info != nil {
-		return fmt.Errorf("devmapper: device %s already exists. Deleted=%v", hash, info.Deleted)
-	}
-
+	// Size parsing and validation only need the base device lock.
 	size, err := devices.parseStorageOpt(storageOpt)
 	if err != nil {
 		return err
@@ -1917,25 +2636,90 @@ func (devices *DeviceSet) AddDevice(hash, baseHash string, storageOpt map[string
 		return fmt.Errorf("devmapper: Container size cannot be smaller than %s", units.HumanSize(float64(baseInfo.Size)))
 	}
 
+	// Device-ID allocation and the transaction around the snapshot have
+	// to be serialized for libdevmapper, so they run under the global
+	// lock; the filesystem grow below does not.
+	devices.Lock()
+
+	// Also include deleted devices in case hash of new device is
+	// same as one of the deleted devices.
+	if info, _ := devices.lookupDevice(hash); info != nil {
+		devices.Unlock()
+		return fmt.Errorf("devmapper: device %s already exists. Deleted=%v", hash, info.Deleted)
+	}
+
 	if err := devices.takeSnapshot(hash, baseInfo, size); err != nil {
+		devices.Unlock()
+		return err
+	}
+
+	info, err := devices.lookupDevice(hash)
+	devices.Unlock()
+	if err != nil {
 		return err
 	}
 
 	// Grow the container rootfs.
 	if size > baseInfo.Size {
-		info, err := devices.lookupDevice(hash)
+		info.lock.Lock()
+		err = devices.growFS(info)
+		info.lock.Unlock()
 		if err != nil {
 			return err
 		}
-
-		if err := devices.growFS(info); err != nil {
-			return err
-		}
 	}
 
 	return nil
 }
 
+// AddExternalSnapshot registers a new thin device whose origin is an
+// external read-only block device instead of an in-pool device, so a
+// prepared golden image can be shared by any number of containers without
+// first importing it into the pool.
+func (devices *DeviceSet) AddExternalSnapshot(hash, originDev string) error {
+	logrus.Debugf("devmapper: AddExternalSnapshot START(hash=%s origin=%s)", hash, originDev)
+	defer logrus.Debugf("devmapper: AddExternalSnapshot END(hash=%s origin=%s)", hash, originDev)
+
+	size, err := devices.externalOriginSize(originDev)
+	if err != nil {
+		return err
+	}
+
+	devices.Lock()
+	defer devices.Unlock()
+
+	// Also include deleted devices in case hash of new device is
+	// same as one of the deleted devices.
+	if info, _ := devices.lookupDevice(hash); info != nil {
+		return fmt.Errorf("devmapper: device %s already exists. Deleted=%v", hash, info.Deleted)
+	}
+
+	return devices.createRegisterExternalSnapshot(hash, originDev, size)
+}
+
+// externalOriginSize validates the external origin block device and
+// returns its size. The kernel requires an external origin to be a whole
+// multiple of the pool block size.
+func (devices *DeviceSet) externalOriginSize(originDev string) (uint64, error) {
+	file, err := os.Open(originDev)
+	if err != nil {
+		return 0, fmt.Errorf("devmapper: Error opening external origin device %s: %v", originDev, err)
+	}
+	defer file.Close()
+
+	size, err := devicemapper.GetBlockDeviceSize(file)
+	if err != nil {
+		return 0, fmt.Errorf("devmapper: Error getting size of external origin device %s: %v", originDev, err)
+	}
+
+	blockSizeBytes := uint64(devices.thinpBlockSize) * 512
+	if size == 0 || size%blockSizeBytes != 0 {
+		return 0, fmt.Errorf("devmapper: External origin device %s size %d is not a multiple of the pool block size %d", originDev, size, blockSizeBytes)
+	}
+
+	return size, nil
+}
+
 func (devices *DeviceSet) parseStorageOpt(storageOpt map[string]string) (uint64, error) {
 
 	// Read size to change the block device size per container.
@@ -2045,9 +2829,58 @@ func (devices *DeviceSet) issueDiscard(info *devInfo) error {
 	return nil
 }
 
+// queueDiscardDelete hands the discard and the remainder of the deletion
+// to a background worker, reporting whether the job was accepted. The
+// device stays registered and activated until the worker has discarded
+// it; a full queue makes the caller fall back to the synchronous path
+// instead of blocking.
+func (devices *DeviceSet) queueDiscardDelete(info *devInfo) bool {
+	devices.discardWG.Add(1)
+	select {
+	case devices.discardJobs <- info:
+		return true
+	default:
+		devices.discardWG.Done()
+		return false
+	}
+}
+
+func (devices *DeviceSet) discardWorker() {
+	for info := range devices.discardJobs {
+		info.lock.Lock()
+		devices.Lock()
+
+		if err := devices.issueDiscard(info); err != nil {
+			logrus.Debugf("devmapper: Error discarding device %s: %v", info.Hash, err)
+		}
+
+		if err := devices.deactivateDeviceMode(info, false); err != nil {
+			logrus.Debugf("devmapper: Error deactivating device: %s", err)
+		} else if err := devices.deleteTransaction(info, false); err != nil {
+			logrus.Warnf("devmapper: Background deletion of device %s failed: %v", info.Hash, err)
+		}
+
+		devices.Unlock()
+		info.lock.Unlock()
+		devices.discardWG.Done()
+	}
+}
+
+// drainDiscards waits until all queued background discards have finished.
+// Must be called without the global lock held, since the workers need it.
+func (devices *DeviceSet) drainDiscards() {
+	if devices.discardJobs == nil {
+		return
+	}
+	devices.discardWG.Wait()
+}
+
 // Should be called with devices.Lock() held.
 func (devices *DeviceSet) deleteDevice(info *devInfo, syncDelete bool) error {
 	if devices.doBlkDiscard {
+		if devices.asyncDiscard && !syncDelete && devices.queueDiscardDelete(info) {
+			return nil
+		}
 		devices.issueDiscard(info)
 	}
 
@@ -2236,6 +3069,19 @@ func (devices *DeviceSet) Shutdown(home string) error {
 	// we will block on this lock till cleanup function exits.
 	devices.deletionWorkerTicker.Stop()
 
+	// Give devices whose deletion was deferred (busy at the time, or
+	// waiting on a deferred removal) one last chance before we go away.
+	// Whatever is still pending survives the restart: the deleted state
+	// is persisted in the device metadata and the deletion worker picks
+	// it up again on the next start.
+	if devices.deferredDelete {
+		devices.cleanupDeletedDevices()
+	}
+
+	// Queued background discards keep their devices registered and
+	// activated; wait for them before deactivating everything.
+	devices.drainDiscards()
+
 	devices.Lock()
 	// Save DeviceSet Metadata first. Docker kills all threads if they
 	// don't finish in certain time. It is possible that Shutdown()
@@ -2304,6 +3150,42 @@ func (devices *DeviceSet) Shutdown(home string) error {
 	}
 	devices.Unlock()
 
+	// All devices are deactivated and all metadata has been written; make
+	// sure it actually reaches stable storage before we report a clean
+	// shutdown, so a power-off right after a graceful stop loses nothing.
+	return devices.Sync()
+}
+
+// Sync fsyncs every metadata file and the metadata directory entry itself,
+// guaranteeing durability of the device map across a power failure.
+func (devices *DeviceSet) Sync() error {
+	devices.Lock()
+	defer devices.Unlock()
+
+	syncer := devices.syncer
+	if syncer == nil {
+		syncer = fsyncPath
+	}
+
+	dir := devices.metadataDir()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("devmapper: Error reading metadata directory %s: %s", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		filePath := path.Join(dir, entry.Name())
+		if err := syncer(filePath); err != nil {
+			return fmt.Errorf("devmapper: Error syncing metadata file %s: %s", filePath, err)
+		}
+	}
+	// Sync the directory entry as well, so renames into the directory are
+	// durable too.
+	if err := syncer(dir); err != nil {
+		return fmt.Errorf("devmapper: Error syncing metadata directory %s: %s", dir, err)
+	}
 	return nil
 }
 
@@ -2335,8 +3217,37 @@ func (devices *DeviceSet) xfsSetNospaceRetries(info *devInfo) error {
 	return nil
 }
 
-// MountDevice mounts the device if not already mounted.
-func (devices *DeviceSet) MountDevice(hash, path, mountLabel string) error {
+// mountOptionsFor computes the mount option string for a device of the given
+// filesystem type. When readOnly is set the device itself is mounted with
+// MS_RDONLY instead of relying on a later remount; for XFS this needs
+// norecovery as well, since XFS otherwise insists on replaying the journal,
+// which fails on a read-only device.
+func (devices *DeviceSet) mountOptionsFor(fstype, mountLabel string, readOnly bool) string {
+	options := ""
+
+	if fstype == "xfs" {
+		// XFS needs nouuid or it can't mount filesystems with the same fs
+		options = joinMountOptions(options, "nouuid")
+		if devices.xfsQuota {
+			options = joinMountOptions(options, "pquota")
+		}
+	}
+
+	if readOnly {
+		options = joinMountOptions(options, "ro")
+		if fstype == "xfs" {
+			options = joinMountOptions(options, "norecovery")
+		}
+	}
+
+	options = joinMountOptions(options, devices.mountOptions)
+	options = joinMountOptions(options, label.FormatMountLabel("", mountLabel))
+	return options
+}
+
+// MountDevice mounts the device if not already mounted. When readOnly is set
+// the root device is mounted read-only rather than read-write.
+func (devices *DeviceSet) MountDevice(hash, path, mountLabel string, readOnly bool) error {
 	info, err := devices.lookupDeviceWithLock(hash)
 	if err != nil {
 		return err
@@ -2349,6 +3260,16 @@ func (devices *DeviceSet) MountDevice(hash, path, mountLabel string) error {
 	info.lock.Lock()
 	defer info.lock.Unlock()
 
+	// A dm.basesize increase only applies to devices created afterwards.
+	// Grow an older device to the configured base size the next time it
+	// is mounted; shrinking is never attempted, and devices that are
+	// already active keep their current size until restarted.
+	if userBaseSize && devices.baseFsSize > info.Size {
+		if err := devices.growDeviceFS(info); err != nil {
+			return err
+		}
+	}
+
 	devices.Lock()
 	defer devices.Unlock()
 
@@ -2361,15 +3282,7 @@ func (devices *DeviceSet) MountDevice(hash, path, mountLabel string) error {
 		return err
 	}
 
-	options := ""
-
-	if fstype == "xfs" {
-		// XFS needs nouuid or it can't mount filesystems with the same fs
-		options = joinMountOptions(options, "nouuid")
-	}
-
-	options = joinMountOptions(options, devices.mountOptions)
-	options = joinMountOptions(options, label.FormatMountLabel("", mountLabel))
+	options := devices.mountOptionsFor(fstype, mountLabel, readOnly)
 
 	if err := mount.Mount(info.DevName(), path, fstype, options); err != nil {
 		return fmt.Errorf("devmapper: Error mounting '%s' on '%s' (fstype='%s' options='%s'): %s\n%v", info.DevName(), path, fstype, options, err, string(dmesg.Dmesg(256)))
@@ -2383,6 +3296,36 @@ func (devices *DeviceSet) MountDevice(hash, path, mountLabel string) error {
 		}
 	}
 
+	if fstype == "xfs" && devices.xfsQuota {
+		if err := devices.setXfsQuota(info, path); err != nil {
+			unix.Unmount(path, unix.MNT_DETACH)
+			devices.deactivateDevice(info)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setXfsQuota applies an xfs project quota to a freshly mounted device,
+// capping it at the device size without resizing the thin device itself.
+// The device ID doubles as the quota project ID, since xfs project IDs
+// are numeric; the hash only appears in errors and logs.
+func (devices *DeviceSet) setXfsQuota(info *devInfo, path string) error {
+	run := devices.runTool
+	if run == nil {
+		run = runToolCommand
+	}
+
+	logrus.Debugf("devmapper: Applying xfs project quota of %d bytes to device %s", info.Size, info.Hash)
+
+	projectID := strconv.Itoa(info.DeviceID)
+	if err := run("xfs_quota", "-x", "-c", fmt.Sprintf("project -s -p %s %s", path, projectID), path); err != nil {
+		return fmt.Errorf("devmapper: Error setting up xfs quota project for device %s: %v", info.Hash, err)
+	}
+	if err := run("xfs_quota", "-x", "-c", fmt.Sprintf("limit -p bhard=%d %s", info.Size, projectID), path); err != nil {
+		return fmt.Errorf("devmapper: Error setting xfs quota limit for device %s: %v", info.Hash, err)
+	}
 	return nil
 }
 
@@ -2487,18 +3430,59 @@ func (devices *DeviceSet) GetDeviceStatus(hash string) (*DevStatus, error) {
 	status.SizeInSectors = sizeInSectors
 	status.MappedSectors = mappedSectors
 	status.HighestMappedSector = highestMappedSector
+	status.AllocatedBytes = mappedSectors * 512
+
+	// Derive the pool block size the same way Status() does; failure to
+	// read the pool status only costs us this field.
+	if totalSizeInSectors, _, _, dataTotal, _, _, _, err := devices.poolStatus(); err == nil && dataTotal > 0 {
+		blockSizeInSectors := totalSizeInSectors / dataTotal
+		status.BlockSize = blockSizeInSectors * 512
+	}
 
 	return status, nil
 }
 
-func (devices *DeviceSet) poolStatus() (totalSizeInSectors, transactionID, dataUsed, dataTotal, metadataUsed, metadataTotal uint64, err error) {
+// lowWatermarkPercent is the usage percentage above which Status warns
+// that the pool is close to exhaustion. A configured dm.min_free_space
+// reserve moves the watermark accordingly; otherwise the default of 90%
+// applies.
+func (devices *DeviceSet) lowWatermarkPercent() uint32 {
+	if devices.minFreeSpacePercent > 0 {
+		return 100 - devices.minFreeSpacePercent
+	}
+	return defaultLowWatermarkPercent
+}
+
+// usageAboveWatermark reports whether used blocks exceed the given
+// percentage of the total.
+func usageAboveWatermark(used, total uint64, percent uint32) bool {
+	if total == 0 {
+		return false
+	}
+	return used*100 > total*uint64(percent)
+}
+
+func (devices *DeviceSet) poolStatus() (totalSizeInSectors, transactionID, dataUsed, dataTotal, metadataUsed, metadataTotal uint64, needsCheck bool, err error) {
 	var params string
 	if _, totalSizeInSectors, _, params, err = devicemapper.GetStatus(devices.getPoolName()); err == nil {
 		_, err = fmt.Sscanf(params, "%d %d/%d %d/%d", &transactionID, &metadataUsed, &metadataTotal, &dataUsed, &dataTotal)
+		needsCheck = poolStatusNeedsCheck(params)
 	}
 	return
 }
 
+// poolStatusNeedsCheck reports whether a thin-pool status parameter line
+// carries the needs_check flag, which the kernel sets when the pool
+// metadata is suspect and should be checked with thin_check.
+func poolStatusNeedsCheck(params string) bool {
+	for _, field := range strings.Fields(params) {
+		if field == "needs_check" {
+			return true
+		}
+	}
+	return false
+}
+
 // DataDevicePath returns the path to the data storage for this deviceset,
 // regardless of loopback or block device
 func (devices *DeviceSet) DataDevicePath() string {
@@ -2532,6 +3516,35 @@ func (devices *DeviceSet) isRealFile(loopFile string) (bool, error) {
 	return false, nil
 }
 
+// DumpMetadata streams a thin_dump of the pool metadata device to w, so
+// the allocation state can be analyzed offline without stopping the
+// daemon. The pool is suspended for the duration of the dump to keep it
+// consistent, and resumed again even when the dump fails.
+func (devices *DeviceSet) DumpMetadata(w io.Writer) error {
+	devices.Lock()
+	defer devices.Unlock()
+
+	metadataDev := devices.MetadataDevicePath()
+	if metadataDev == "" {
+		return fmt.Errorf("devmapper: No metadata device to dump")
+	}
+
+	if err := devicemapper.SuspendDevice(devices.getPoolName()); err != nil {
+		return fmt.Errorf("devmapper: Unable to suspend pool: %s", err)
+	}
+	defer func() {
+		if err := devicemapper.ResumeDevice(devices.getPoolName()); err != nil {
+			logrus.Errorf("devmapper: Unable to resume pool after metadata dump: %s", err)
+		}
+	}()
+
+	run := devices.dump
+	if run == nil {
+		run = runDumpCommand
+	}
+	return run(w, "thin_dump", metadataDev)
+}
+
 // Status returns the current status of this deviceset
 func (devices *DeviceSet) Status() *Status {
 	devices.Lock()
@@ -2551,7 +3564,7 @@ func (devices *DeviceSet) Status() *Status {
 	status.BaseDeviceSize = devices.getBaseDeviceSize()
 	status.BaseDeviceFS = devices.getBaseDeviceFS()
 
-	totalSizeInSectors, _, dataUsed, dataTotal, metadataUsed, metadataTotal, err := devices.poolStatus()
+	totalSizeInSectors, _, dataUsed, dataTotal, metadataUsed, metadataTotal, needsCheck, err := devices.poolStatus()
 	if err == nil {
 		// Convert from blocks to bytes
 		blockSizeInSectors := totalSizeInSectors / dataTotal
@@ -2583,6 +3596,10 @@ func (devices *DeviceSet) Status() *Status {
 
 		minFreeData := (dataTotal * uint64(devices.minFreeSpacePercent)) / 100
 		status.MinFreeSpace = minFreeData * blockSizeInSectors * 512
+		status.MetadataNeedsCheck = needsCheck
+
+		status.DataLowWatermark = usageAboveWatermark(dataUsed, dataTotal, devices.lowWatermarkPercent())
+		status.MetadataLowWatermark = usageAboveWatermark(metadataUsed, metadataTotal, devices.lowWatermarkPercent())
 	}
 
 	return status
@@ -2598,7 +3615,17 @@ func (devices *DeviceSet) exportDeviceMetadata(hash string) (*deviceMetadata, er
 	info.lock.Lock()
 	defer info.lock.Unlock()
 
-	metadata := &deviceMetadata{info.DeviceID, info.Size, info.Name()}
+	metadata := &deviceMetadata{deviceID: info.DeviceID, deviceSize: info.Size, deviceName: info.Name()}
+
+	// Report real consumption when the device happens to be active;
+	// inspect must not force an activation just for this.
+	devices.Lock()
+	defer devices.Unlock()
+	if devinfo, _ := devicemapper.GetInfo(info.Name()); devinfo != nil && devinfo.Exists != 0 {
+		if _, mappedSectors, _, err := devices.deviceStatus(info.DevName()); err == nil {
+			metadata.deviceUsed = mappedSectors * 512
+		}
+	}
 	return metadata, nil
 }
 
@@ -2620,6 +3647,7 @@ func NewDeviceSet(root string, doInit bool, options []string, uidMaps, gidMaps [
 		uidMaps:               uidMaps,
 		gidMaps:               gidMaps,
 		minFreeSpacePercent:   defaultMinFreeSpacePercent,
+		pool:                  devicemapperPool{},
 	}
 
 	version, err := devicemapper.GetDriverVersion()
@@ -2673,6 +3701,20 @@ func NewDeviceSet(root string, doInit bool, options []string, uidMaps, gidMaps [
 			devices.filesystem = val
 		case "dm.mkfsarg":
 			devices.mkfsArgs = append(devices.mkfsArgs, val)
+		case "dm.mkfs_timeout":
+			timeout, err := time.ParseDuration(val)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not parse `dm.mkfs_timeout=%s`", val)
+			}
+			if timeout < 0 {
+				return nil, errors.New("dm.mkfs_timeout cannot be negative")
+			}
+			devices.mkfsTimeout = timeout
+		case "dm.metadata_backup_dir":
+			if !filepath.IsAbs(val) {
+				return nil, fmt.Errorf("devmapper: Option dm.metadata_backup_dir requires an absolute path")
+			}
+			devices.metadataBackupDir = val
 		case "dm.mountopt":
 			devices.mountOptions = joinMountOptions(devices.mountOptions, val)
 		case "dm.metadatadev":
@@ -2712,6 +3754,42 @@ func NewDeviceSet(root string, doInit bool, options []string, uidMaps, gidMaps [
 				return nil, err
 			}
 
+		case "dm.skip_deferred_removal_probe":
+			devices.skipDeferredRemovalProbe, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, err
+			}
+
+		case "dm.repair_metadata":
+			// Destructive, advanced option: attempt automatic metadata
+			// repair before creating the pool. Must be explicitly
+			// requested.
+			devices.repairMetadata, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, err
+			}
+
+		case "dm.async_discard":
+			devices.asyncDiscard, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, err
+			}
+
+		case "dm.xfs_quota":
+			devices.xfsQuota, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, err
+			}
+
+		case "dm.error_if_no_space":
+			// With this set, writes on a full pool fail fast with ENOSPC
+			// instead of being queued; queued I/O can hang containers but
+			// gives the operator a chance to grow the pool without errors.
+			devices.errorIfNoSpace, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, err
+			}
+
 		case "dm.min_free_space":
 			if !strings.HasSuffix(val, "%") {
 				return nil, fmt.Errorf("devmapper: Option dm.min_free_space requires %% suffix")
@@ -2794,6 +3872,10 @@ func NewDeviceSet(root string, doInit bool, options []string, uidMaps, gidMaps [
 		}
 	}
 
+	if err := validateMkfsArgs(devices.mkfsArgs); err != nil {
+		return nil, err
+	}
+
 	if err := validateLVMConfig(lvmSetupConfig); err != nil {
 		return nil, err
 	}
@@ -2805,6 +3887,13 @@ func NewDeviceSet(root string, doInit bool, options []string, uidMaps, gidMaps [
 		devices.doBlkDiscard = false
 	}
 
+	if devices.asyncDiscard && devices.doBlkDiscard {
+		devices.discardJobs = make(chan *devInfo, discardQueueSize)
+		for i := 0; i < discardWorkers; i++ {
+			go devices.discardWorker()
+		}
+	}
+
 	if err := devices.initDevmapper(doInit); err != nil {
 		return nil, err
 	}
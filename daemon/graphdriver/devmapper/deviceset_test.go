@@ -0,0 +1,931 @@
+// +build linux
+
+package devmapper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateMkfsArgs(t *testing.T) {
+	valid := [][]string{
+		nil,
+		{"-O", "^has_journal"},
+		{"-E", "nodiscard"},
+		{"-m", "5"},
+		{"-i", "size=512"},
+		{"-d", "agcount=4"},
+	}
+	for _, args := range valid {
+		if err := validateMkfsArgs(args); err != nil {
+			t.Errorf("expected args %v to be accepted, got %v", args, err)
+		}
+	}
+
+	invalid := [][]string{
+		{"-d", "size=20G"},
+		{"-d size=20G"},
+		{"-dsize=20G"},
+		{"1048576"},
+		{"-O", "^has_journal", "4096m"},
+	}
+	for _, args := range invalid {
+		err := validateMkfsArgs(args)
+		if err == nil {
+			t.Errorf("expected args %v to be rejected", args)
+			continue
+		}
+		if got := err.Error(); !strings.Contains(got, "dm.basesize") {
+			t.Errorf("expected error for %v to mention dm.basesize, got %q", args, got)
+		}
+	}
+}
+
+// fakePool implements poolManager in memory, tracking the pool transaction ID
+// and deleted device IDs so the transaction state machine can be tested
+// without a real thin pool.
+type fakePool struct {
+	transactionID uint64
+	createdIDs    []int
+	deletedIDs    []int
+}
+
+func (p *fakePool) SetTransactionID(poolName string, oldID, newID uint64) error {
+	if p.transactionID != oldID {
+		return fmt.Errorf("transaction ID mismatch: pool at %d, expected %d", p.transactionID, oldID)
+	}
+	p.transactionID = newID
+	return nil
+}
+
+func (p *fakePool) CreateDevice(poolName string, deviceID int) error {
+	p.createdIDs = append(p.createdIDs, deviceID)
+	return nil
+}
+
+func (p *fakePool) DeleteDevice(poolName string, deviceID int) error {
+	p.deletedIDs = append(p.deletedIDs, deviceID)
+	return nil
+}
+
+func newTestDeviceSet(t testing.TB, pool poolManager) *DeviceSet {
+	root, err := ioutil.TempDir("", "devmapper-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := &DeviceSet{
+		root:        root,
+		metaData:    metaData{Devices: make(map[string]*devInfo)},
+		deviceIDMap: make([]byte, deviceIDMapSz),
+		pool:        pool,
+	}
+	if err := os.MkdirAll(devices.metadataDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return devices
+}
+
+func TestTransactionCommit(t *testing.T) {
+	pool := &fakePool{}
+	devices := newTestDeviceSet(t, pool)
+	defer os.RemoveAll(devices.root)
+
+	if err := devices.openTransaction("hash1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if devices.OpenTransactionID != devices.TransactionID+1 {
+		t.Fatalf("expected open transaction ID %d, got %d", devices.TransactionID+1, devices.OpenTransactionID)
+	}
+	if _, err := os.Stat(devices.transactionMetaFile()); err != nil {
+		t.Fatalf("expected transaction metadata to be saved: %v", err)
+	}
+
+	if err := devices.closeTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	if devices.TransactionID != devices.OpenTransactionID {
+		t.Fatalf("expected transaction ID to advance to %d, got %d", devices.OpenTransactionID, devices.TransactionID)
+	}
+	if pool.transactionID != devices.TransactionID {
+		t.Fatalf("expected pool transaction ID %d, got %d", devices.TransactionID, pool.transactionID)
+	}
+}
+
+func TestProcessPendingTransactionRollback(t *testing.T) {
+	pool := &fakePool{}
+	devices := newTestDeviceSet(t, pool)
+	defer os.RemoveAll(devices.root)
+
+	// Simulate a crash after a transaction was opened and the device
+	// created, but before the transaction was closed: the transaction
+	// metadata survives and the pool never learned the new ID.
+	deviceID := 5
+	devices.markDeviceIDUsed(deviceID)
+	if err := devices.openTransaction("hash5", deviceID); err != nil {
+		t.Fatal(err)
+	}
+	info := &devInfo{Hash: "hash5", DeviceID: deviceID, TransactionID: devices.OpenTransactionID}
+	if err := devices.saveMetadata(info); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := devices.processPendingTransaction(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pool.deletedIDs) != 1 || pool.deletedIDs[0] != deviceID {
+		t.Fatalf("expected device %d to be deleted from the pool, got %v", deviceID, pool.deletedIDs)
+	}
+	if !devices.isDeviceIDFree(deviceID) {
+		t.Fatal("expected rolled back device ID to be freed")
+	}
+	if _, err := os.Stat(devices.metadataFile(info)); !os.IsNotExist(err) {
+		t.Fatalf("expected device metadata to be removed, got %v", err)
+	}
+	if _, err := os.Stat(devices.transactionMetaFile()); !os.IsNotExist(err) {
+		t.Fatalf("expected transaction metadata to be removed, got %v", err)
+	}
+	if devices.OpenTransactionID != devices.TransactionID {
+		t.Fatal("expected open transaction ID to be reset after rollback")
+	}
+}
+
+func TestProcessPendingTransactionNothingToRollback(t *testing.T) {
+	pool := &fakePool{}
+	devices := newTestDeviceSet(t, pool)
+	defer os.RemoveAll(devices.root)
+
+	// Committed transaction: open followed by close. A restart must not
+	// roll anything back.
+	if err := devices.openTransaction("hash1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := devices.closeTransaction(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newTestDeviceSet(t, pool)
+	defer os.RemoveAll(restarted.root)
+	restarted.TransactionID = devices.TransactionID
+
+	if err := restarted.processPendingTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.deletedIDs) != 0 {
+		t.Fatalf("expected no rollback, got deleted IDs %v", pool.deletedIDs)
+	}
+}
+
+func TestDeviceSetMetaDataBackupRoundTrip(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	backupDir, err := ioutil.TempDir("", "devmapper-test-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(backupDir)
+	devices.metadataBackupDir = backupDir
+
+	devices.BaseDeviceUUID = "test-uuid"
+	devices.BaseDeviceFilesystem = "ext4"
+	if err := devices.saveDeviceSetMetaData(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(devices.deviceSetMetaFile()); err != nil {
+		t.Fatalf("expected primary deviceset metadata to be written: %v", err)
+	}
+	if _, err := os.Stat(devices.deviceSetMetaBackupFile()); err != nil {
+		t.Fatalf("expected backup deviceset metadata to be written: %v", err)
+	}
+
+	// Corrupt the primary; loading must fall back to the backup.
+	if err := ioutil.WriteFile(devices.deviceSetMetaFile(), []byte("{garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(restored.root)
+	restored.root = devices.root
+	restored.metadataBackupDir = backupDir
+	if err := restored.loadDeviceSetMetaData(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.BaseDeviceUUID != "test-uuid" || restored.BaseDeviceFilesystem != "ext4" {
+		t.Fatalf("expected metadata restored from backup, got UUID %q fs %q", restored.BaseDeviceUUID, restored.BaseDeviceFilesystem)
+	}
+
+	// A missing primary must also be recovered from the backup.
+	if err := os.Remove(devices.deviceSetMetaFile()); err != nil {
+		t.Fatal(err)
+	}
+	restored = newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(restored.root)
+	restored.root = devices.root
+	restored.metadataBackupDir = backupDir
+	if err := restored.loadDeviceSetMetaData(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.BaseDeviceUUID != "test-uuid" {
+		t.Fatalf("expected base UUID restored from backup, got %q", restored.BaseDeviceUUID)
+	}
+}
+
+func TestReconcileDeviceIDMap(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	// A bit set with no backing device metadata is a leaked ID and must
+	// be freed.
+	devices.markDeviceIDUsed(7)
+
+	// A device whose ID bit is not set would let the ID be allocated
+	// twice and must be marked used.
+	devices.Devices["hash9"] = &devInfo{Hash: "hash9", DeviceID: 9}
+
+	devices.reconcileDeviceIDMap()
+
+	if !devices.isDeviceIDFree(7) {
+		t.Error("expected leaked device ID 7 to be freed")
+	}
+	if devices.isDeviceIDFree(9) {
+		t.Error("expected device ID 9 to be marked used")
+	}
+}
+
+func TestMountOptionsForReadOnly(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	if options := devices.mountOptionsFor("ext4", "", false); strings.Contains(options, "ro") {
+		t.Errorf("expected no ro option for a read-write mount, got %q", options)
+	}
+
+	options := devices.mountOptionsFor("ext4", "", true)
+	if !strings.Contains(options, "ro") {
+		t.Errorf("expected ro option for a read-only mount, got %q", options)
+	}
+
+	options = devices.mountOptionsFor("xfs", "", true)
+	if !strings.Contains(options, "ro") || !strings.Contains(options, "norecovery") {
+		t.Errorf("expected ro and norecovery options for a read-only xfs mount, got %q", options)
+	}
+
+	devices.mountOptions = "discard"
+	if options := devices.mountOptionsFor("ext4", "", true); !strings.Contains(options, "discard") {
+		t.Errorf("expected configured mount options to be preserved, got %q", options)
+	}
+}
+
+func TestDeviceSetManager(t *testing.T) {
+	manager := NewDeviceSetManager()
+
+	setA := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(setA.root)
+	setB := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(setB.root)
+
+	if err := manager.Add("tenant-a", setA); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Add("tenant-b", setB); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Add("tenant-a", setA); err == nil {
+		t.Fatal("expected error registering a duplicate name")
+	}
+
+	if got := manager.Get("tenant-a"); got != setA {
+		t.Fatalf("expected Get to return the registered set, got %v", got)
+	}
+	if got := manager.Get("missing"); got != nil {
+		t.Fatalf("expected nil for an unknown name, got %v", got)
+	}
+
+	names := manager.Names()
+	if len(names) != 2 || names[0] != "tenant-a" || names[1] != "tenant-b" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+}
+
+func TestDeviceSetManagerShutdown(t *testing.T) {
+	manager := NewDeviceSetManager()
+
+	for _, name := range []string{"tenant-a", "tenant-b"} {
+		set := newTestDeviceSet(t, &fakePool{})
+		defer os.RemoveAll(set.root)
+		// Avoid touching the real device mapper during Shutdown.
+		set.thinPoolDevice = "fake-pool"
+		set.deletionWorkerTicker = time.NewTicker(time.Second * 30)
+		if err := manager.Add(name, set); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := manager.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shutdown must save each set's metadata against its own root.
+	for _, name := range manager.Names() {
+		set := manager.Get(name)
+		if _, err := os.Stat(set.deviceSetMetaFile()); err != nil {
+			t.Errorf("expected deviceset metadata for %s: %v", name, err)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	if err := devices.saveDeviceSetMetaData(); err != nil {
+		t.Fatal(err)
+	}
+
+	var synced []string
+	devices.syncer = func(path string) error {
+		synced = append(synced, path)
+		return nil
+	}
+
+	if err := devices.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	foundMetaFile := false
+	for _, p := range synced {
+		if p == devices.deviceSetMetaFile() {
+			foundMetaFile = true
+		}
+	}
+	if !foundMetaFile {
+		t.Errorf("expected %s to be synced, got %v", devices.deviceSetMetaFile(), synced)
+	}
+	if len(synced) == 0 || synced[len(synced)-1] != devices.metadataDir() {
+		t.Errorf("expected the metadata directory to be synced last, got %v", synced)
+	}
+}
+
+func TestSyncError(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	devices.syncer = func(path string) error {
+		return fmt.Errorf("sync failure")
+	}
+	if err := devices.Sync(); err == nil || !strings.Contains(err.Error(), "sync failure") {
+		t.Errorf("expected sync failure to propagate, got %v", err)
+	}
+}
+
+func TestPoolFeatures(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	if features := devices.poolFeatures(); len(features) != 0 {
+		t.Errorf("expected no extra pool features by default, got %v", features)
+	}
+
+	devices.errorIfNoSpace = true
+	features := devices.poolFeatures()
+	if len(features) != 1 || features[0] != "error_if_no_space" {
+		t.Errorf("expected [error_if_no_space], got %v", features)
+	}
+}
+
+func TestPoolStatusNeedsCheck(t *testing.T) {
+	samples := map[string]bool{
+		"4 409/524288 759/1572864 - rw discard_passdown queue_if_no_space -":           false,
+		"4 409/524288 759/1572864 - rw discard_passdown error_if_no_space needs_check": true,
+		"0 0/524288 0/1572864 - rw no_discard_passdown queue_if_no_space":              false,
+		"": false,
+	}
+	for params, want := range samples {
+		if got := poolStatusNeedsCheck(params); got != want {
+			t.Errorf("poolStatusNeedsCheck(%q) = %v, want %v", params, got, want)
+		}
+	}
+}
+
+func TestCheckRepairMetadata(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	metadataDev := devices.root + "/fake-metadata"
+	if err := ioutil.WriteFile(metadataDev, []byte("damaged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Healthy metadata: thin_check passes, no repair attempted.
+	var invocations [][]string
+	devices.runTool = func(name string, args ...string) error {
+		invocations = append(invocations, append([]string{name}, args...))
+		return nil
+	}
+	if err := devices.checkRepairMetadata(metadataDev); err != nil {
+		t.Fatal(err)
+	}
+	if len(invocations) != 1 || invocations[0][0] != "thin_check" {
+		t.Fatalf("expected a single thin_check invocation, got %v", invocations)
+	}
+
+	// Damaged metadata: thin_check fails once, thin_repair writes a
+	// repaired copy which is swapped in and re-checked.
+	invocations = nil
+	devices.runTool = func(name string, args ...string) error {
+		invocations = append(invocations, append([]string{name}, args...))
+		if name == "thin_check" && len(invocations) == 1 {
+			return fmt.Errorf("metadata contains errors")
+		}
+		if name == "thin_repair" {
+			return ioutil.WriteFile(args[3], []byte("repaired"), 0600)
+		}
+		return nil
+	}
+	if err := devices.checkRepairMetadata(metadataDev); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"thin_check", metadataDev},
+		{"thin_repair", "-i", metadataDev, "-o", devices.metadataDir() + "/metadata.repair"},
+		{"thin_check", metadataDev},
+	}
+	if len(invocations) != len(want) {
+		t.Fatalf("expected invocations %v, got %v", want, invocations)
+	}
+	for i := range want {
+		if strings.Join(invocations[i], " ") != strings.Join(want[i], " ") {
+			t.Errorf("invocation %d: expected %v, got %v", i, want[i], invocations[i])
+		}
+	}
+	content, err := ioutil.ReadFile(metadataDev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "repaired" {
+		t.Errorf("expected repaired metadata to be copied back, got %q", content)
+	}
+
+	// Repair failure propagates.
+	devices.runTool = func(name string, args ...string) error {
+		return fmt.Errorf("%s failed", name)
+	}
+	if err := devices.checkRepairMetadata(metadataDev); err == nil {
+		t.Error("expected an error when thin_repair fails")
+	}
+}
+
+func TestResizeInProgressMarker(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	if err := devices.markResizeInProgress(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(devices.resizeMetaFile())
+	if err != nil {
+		t.Fatalf("expected a resize marker: %v", err)
+	}
+	if string(content) != devices.getPoolName() {
+		t.Errorf("expected marker to record pool name %q, got %q", devices.getPoolName(), content)
+	}
+
+	if err := devices.clearResizeInProgress(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(devices.resizeMetaFile()); !os.IsNotExist(err) {
+		t.Errorf("expected marker to be removed, got %v", err)
+	}
+
+	// Clearing an absent marker is not an error.
+	if err := devices.clearResizeInProgress(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkConcurrentDeviceRegistration measures contention on the global
+// lock for the part of device creation that has to stay serialized for
+// libdevmapper: transaction handling and metadata registration. Creating
+// real snapshot devices needs a thin pool, so the libdevmapper snapshot
+// call itself is not part of the benchmark.
+func BenchmarkConcurrentDeviceRegistration(b *testing.B) {
+	devices := newTestDeviceSet(b, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := int(atomic.AddInt64(&next, 1))
+			hash := fmt.Sprintf("bench-%d", id)
+
+			devices.Lock()
+			err := devices.openTransaction(hash, id)
+			if err == nil {
+				_, err = devices.registerDevice(id, hash, 64*1024, devices.OpenTransactionID)
+			}
+			if err == nil {
+				err = devices.closeTransaction()
+			}
+			devices.Unlock()
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestDeviceSetMetaDataSchemaMigration(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	// A v0 file predates the schema_version field entirely.
+	v0 := []byte(`{"next_device_id":4,"BaseDeviceUUID":"test-uuid","BaseDeviceFilesystem":"ext4"}`)
+	if err := ioutil.WriteFile(devices.deviceSetMetaFile(), v0, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := devices.loadDeviceSetMetaData(); err != nil {
+		t.Fatal(err)
+	}
+	if devices.SchemaVersion != deviceSetSchemaVersion {
+		t.Fatalf("expected schema version %d after migration, got %d", deviceSetSchemaVersion, devices.SchemaVersion)
+	}
+	if devices.NextDeviceID != 4 || devices.BaseDeviceUUID != "test-uuid" {
+		t.Fatalf("expected v0 fields to survive migration, got id %d uuid %q", devices.NextDeviceID, devices.BaseDeviceUUID)
+	}
+
+	// The migrated version must have been written back.
+	jsonData, err := ioutil.ReadFile(devices.deviceSetMetaFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(jsonData), fmt.Sprintf(`"schema_version":%d`, deviceSetSchemaVersion)) {
+		t.Fatalf("expected schema version to be persisted, got %s", jsonData)
+	}
+
+	// A second load must be a no-op.
+	if err := devices.loadDeviceSetMetaData(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeviceSetMetaDataSchemaTooNew(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	tooNew := []byte(fmt.Sprintf(`{"schema_version":%d}`, deviceSetSchemaVersion+1))
+	if err := ioutil.WriteFile(devices.deviceSetMetaFile(), tooNew, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := devices.loadDeviceSetMetaData()
+	if err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Fatalf("expected a too-new schema version to be rejected, got %v", err)
+	}
+}
+
+func TestCreateRegisterExternalSnapshot(t *testing.T) {
+	pool := &fakePool{}
+	devices := newTestDeviceSet(t, pool)
+	defer os.RemoveAll(devices.root)
+
+	size := uint64(64 * 1024 * 1024)
+	if err := devices.createRegisterExternalSnapshot("golden", "/dev/sdz1", size); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := devices.lookupDevice("golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ExternalOrigin != "/dev/sdz1" {
+		t.Errorf("expected external origin to be recorded, got %q", info.ExternalOrigin)
+	}
+	if info.Size != size {
+		t.Errorf("expected device size %d, got %d", size, info.Size)
+	}
+	if len(pool.createdIDs) != 1 || pool.createdIDs[0] != info.DeviceID {
+		t.Errorf("expected device %d to be created in the pool, got %v", info.DeviceID, pool.createdIDs)
+	}
+	if devices.TransactionID != devices.OpenTransactionID || pool.transactionID != devices.TransactionID {
+		t.Errorf("expected transaction to be committed, pool at %d, set at %d/%d", pool.transactionID, devices.TransactionID, devices.OpenTransactionID)
+	}
+
+	// The external-origin marker must survive a metadata reload.
+	delete(devices.Devices, "golden")
+	reloaded := devices.loadMetadata("golden")
+	if reloaded == nil {
+		t.Fatal("expected device metadata on disk")
+	}
+	if reloaded.ExternalOrigin != "/dev/sdz1" {
+		t.Errorf("expected external origin to be persisted, got %q", reloaded.ExternalOrigin)
+	}
+}
+
+func TestGetDeviceUUIDRetry(t *testing.T) {
+	defer func(orig func(string) ([]byte, error)) { uuidCommand = orig }(uuidCommand)
+
+	// The first calls lose the udev race; the UUID shows up afterwards.
+	calls := 0
+	uuidCommand = func(device string) ([]byte, error) {
+		calls++
+		if calls < 3 {
+			return []byte("\n"), nil
+		}
+		return []byte("a1b2c3d4\n"), nil
+	}
+	uuid, err := getDeviceUUID("/dev/mapper/test-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uuid != "a1b2c3d4" {
+		t.Errorf("expected uuid a1b2c3d4, got %q", uuid)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+
+	// A device that never settles must produce a clear error.
+	uuidCommand = func(device string) ([]byte, error) {
+		return nil, fmt.Errorf("blkid exploded")
+	}
+	_, err = getDeviceUUID("/dev/mapper/test-dev")
+	if err == nil || !strings.Contains(err.Error(), "blkid exploded") {
+		t.Fatalf("expected last blkid error to be reported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("%d attempts", deviceUUIDMaxRetries)) {
+		t.Errorf("expected attempt count in error, got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+	devices.TransactionID = 10
+
+	devices.Devices[""] = &devInfo{Hash: "", DeviceID: 1, TransactionID: 1}
+	devices.Devices["aaa"] = &devInfo{Hash: "aaa", DeviceID: 2, TransactionID: 2}
+	// Shares its device ID with "aaa".
+	devices.Devices["dup"] = &devInfo{Hash: "dup", DeviceID: 2, TransactionID: 3}
+	// Registered under a transaction the pool never committed.
+	devices.Devices["uncommitted"] = &devInfo{Hash: "uncommitted", DeviceID: 3, TransactionID: 11}
+	// Out of range ID.
+	devices.Devices["bogus"] = &devInfo{Hash: "bogus", DeviceID: maxDeviceID + 1, TransactionID: 4}
+
+	bad, err := devices.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"bogus", "dup", "uncommitted"}
+	if len(bad) != len(expected) {
+		t.Fatalf("expected inconsistent devices %v, got %v", expected, bad)
+	}
+	for i, hash := range expected {
+		if bad[i] != hash {
+			t.Fatalf("expected inconsistent devices %v, got %v", expected, bad)
+		}
+	}
+
+	// Verify must not mutate anything.
+	if len(devices.Devices) != 5 {
+		t.Errorf("expected device map to be untouched, got %d entries", len(devices.Devices))
+	}
+}
+
+func TestRepair(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+	devices.TransactionID = 10
+
+	good := &devInfo{Hash: "good", DeviceID: 2, TransactionID: 2, devices: devices}
+	leaked := &devInfo{Hash: "leaked", DeviceID: 3, TransactionID: 11, devices: devices}
+	devices.Devices["good"] = good
+	devices.Devices["leaked"] = leaked
+	for _, info := range []*devInfo{good, leaked} {
+		devices.markDeviceIDUsed(info.DeviceID)
+		if err := devices.saveMetadata(info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bad, err := devices.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 1 || bad[0] != "leaked" {
+		t.Fatalf("expected only the leaked device to be reported, got %v", bad)
+	}
+
+	if err := devices.Repair(bad); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := devices.Devices["leaked"]; ok {
+		t.Error("expected leaked device to be unregistered")
+	}
+	if _, err := os.Stat(devices.metadataFile(leaked)); !os.IsNotExist(err) {
+		t.Errorf("expected leaked device metadata to be removed, got %v", err)
+	}
+	if !devices.isDeviceIDFree(leaked.DeviceID) {
+		t.Error("expected leaked device ID to be freed")
+	}
+	if devices.isDeviceIDFree(good.DeviceID) {
+		t.Error("expected surviving device to keep its ID")
+	}
+	if _, err := os.Stat(devices.deviceSetMetaFile()); err != nil {
+		t.Errorf("expected deviceset metadata to be rewritten: %v", err)
+	}
+
+	// Unknown hashes must be rejected before anything is touched.
+	if err := devices.Repair([]string{"nope"}); err == nil {
+		t.Error("expected repair of an unknown device to fail")
+	}
+}
+
+func TestRunMkfsCommand(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	// Failures must surface the command output.
+	err := devices.runMkfsCommand("sh", "-c", "echo boom >&2; exit 1")
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected command output in error, got %v", err)
+	}
+
+	// A hung command must be killed once the timeout expires.
+	devices.mkfsTimeout = 50 * time.Millisecond
+	err = devices.runMkfsCommand("sleep", "10")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+
+	devices.mkfsTimeout = time.Minute
+	if err := devices.runMkfsCommand("true"); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+}
+
+func TestSetXfsQuota(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+	devices.xfsQuota = true
+
+	var invocations [][]string
+	devices.runTool = func(name string, args ...string) error {
+		invocations = append(invocations, append([]string{name}, args...))
+		return nil
+	}
+
+	info := &devInfo{Hash: "abc", DeviceID: 7, Size: 1024 * 1024, devices: devices}
+	if err := devices.setXfsQuota(info, "/mnt/test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(invocations) != 2 {
+		t.Fatalf("expected 2 xfs_quota invocations, got %v", invocations)
+	}
+	if invocations[0][0] != "xfs_quota" || !strings.Contains(invocations[0][3], "project -s -p /mnt/test 7") {
+		t.Errorf("unexpected project setup invocation %v", invocations[0])
+	}
+	if !strings.Contains(invocations[1][3], fmt.Sprintf("limit -p bhard=%d 7", info.Size)) {
+		t.Errorf("unexpected limit invocation %v", invocations[1])
+	}
+
+	// The quota mount option must be requested for xfs when enabled.
+	if opts := devices.mountOptionsFor("xfs", "", false); !strings.Contains(opts, "pquota") {
+		t.Errorf("expected pquota mount option, got %q", opts)
+	}
+	devices.xfsQuota = false
+	if opts := devices.mountOptionsFor("xfs", "", false); strings.Contains(opts, "pquota") {
+		t.Errorf("expected no pquota mount option when disabled, got %q", opts)
+	}
+}
+
+func TestFreeDeviceIDList(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	// A freshly freed ID must be handed out again without scanning.
+	devices.markDeviceIDUsed(42)
+	devices.markDeviceIDFree(42)
+	id, err := devices.getNextFreeDeviceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 {
+		t.Errorf("expected recently freed ID 42, got %d", id)
+	}
+	if devices.isDeviceIDFree(42) {
+		t.Error("expected handed out ID to be marked used")
+	}
+
+	// Stale entries (ID re-marked used behind the list's back) must be
+	// skipped, falling back to the scan.
+	devices.markDeviceIDFree(7)
+	devices.markDeviceIDUsed(7)
+	id, err = devices.getNextFreeDeviceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == 7 {
+		t.Error("expected stale free-list entry to be skipped")
+	}
+	if len(devices.freeDeviceIDs) != 0 {
+		t.Errorf("expected free list to be drained, got %v", devices.freeDeviceIDs)
+	}
+
+	// The list is bounded.
+	for i := 0; i < maxFreeDeviceIDs+100; i++ {
+		devices.markDeviceIDFree(i)
+	}
+	if len(devices.freeDeviceIDs) != maxFreeDeviceIDs {
+		t.Errorf("expected free list to be capped at %d, got %d", maxFreeDeviceIDs, len(devices.freeDeviceIDs))
+	}
+}
+
+func TestLowWatermark(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	// Default watermark is 90%; dm.min_free_space moves it.
+	if percent := devices.lowWatermarkPercent(); percent != defaultLowWatermarkPercent {
+		t.Errorf("expected default watermark %d, got %d", defaultLowWatermarkPercent, percent)
+	}
+	devices.minFreeSpacePercent = 25
+	if percent := devices.lowWatermarkPercent(); percent != 75 {
+		t.Errorf("expected watermark 75 with 25%% reserve, got %d", percent)
+	}
+
+	if usageAboveWatermark(89, 100, 90) {
+		t.Error("expected 89/100 to be below a 90% watermark")
+	}
+	if !usageAboveWatermark(91, 100, 90) {
+		t.Error("expected 91/100 to be above a 90% watermark")
+	}
+	if usageAboveWatermark(90, 100, 90) {
+		t.Error("expected exactly 90/100 not to trigger the warning")
+	}
+	if usageAboveWatermark(1, 0, 90) {
+		t.Error("expected an empty pool not to trigger the warning")
+	}
+}
+
+func TestRunDumpCommand(t *testing.T) {
+	var buf bytes.Buffer
+	if err := runDumpCommand(&buf, "sh", "-c", "echo '<superblock/>'"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<superblock/>") {
+		t.Errorf("expected command output to be streamed, got %q", buf.String())
+	}
+
+	err := runDumpCommand(&buf, "sh", "-c", "echo broken metadata >&2; exit 1")
+	if err == nil || !strings.Contains(err.Error(), "broken metadata") {
+		t.Fatalf("expected stderr in error, got %v", err)
+	}
+}
+
+func TestQueueDiscardDelete(t *testing.T) {
+	devices := newTestDeviceSet(t, &fakePool{})
+	defer os.RemoveAll(devices.root)
+
+	devices.discardJobs = make(chan *devInfo, 1)
+
+	info := &devInfo{Hash: "a"}
+	if !devices.queueDiscardDelete(info) {
+		t.Fatal("expected first job to be queued")
+	}
+	if devices.queueDiscardDelete(&devInfo{Hash: "b"}) {
+		t.Error("expected a full queue to reject the job")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		devices.drainDiscards()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("drainDiscards returned with a job still queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Stand in for a worker: consume the job and mark it finished.
+	if got := <-devices.discardJobs; got != info {
+		t.Errorf("unexpected job %v", got)
+	}
+	devices.discardWG.Done()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("drainDiscards did not return after the queue drained")
+	}
+}
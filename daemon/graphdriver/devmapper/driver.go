@@ -119,6 +119,10 @@ func (d *Driver) GetMetadata(id string) (map[string]string, error) {
 	metadata := make(map[string]string)
 	metadata["DeviceId"] = strconv.Itoa(m.deviceID)
 	metadata["DeviceSize"] = strconv.FormatUint(m.deviceSize, 10)
+	// DeviceUsed is the number of bytes actually mapped in the pool, as
+	// opposed to the provisioned DeviceSize; it is 0 while the device is
+	// not active.
+	metadata["DeviceUsed"] = strconv.FormatUint(m.deviceUsed, 10)
 	metadata["DeviceName"] = m.deviceName
 	return metadata, nil
 }
@@ -194,7 +198,9 @@ func (d *Driver) Get(id, mountLabel string) (containerfs.ContainerFS, error) {
 	}
 
 	// Mount the device
-	if err := d.DeviceSet.MountDevice(id, mp, mountLabel); err != nil {
+	// The root device is mounted read-write; a read-only container root
+	// is enforced by the runtime on top of this mount.
+	if err := d.DeviceSet.MountDevice(id, mp, mountLabel, false); err != nil {
 		d.ctr.Decrement(mp)
 		return nil, err
 	}
@@ -0,0 +1,99 @@
+// +build linux
+
+package devmapper
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/pkg/idtools"
+)
+
+// DeviceSetManager tracks multiple named device sets, so separate thin pools
+// can coexist under one daemon (for example one pool per tenant). Each set
+// keeps its own root, device prefix and locking; the manager's lock only
+// guards the name table, never an individual set's operations.
+type DeviceSetManager struct {
+	mu   sync.Mutex
+	sets map[string]*DeviceSet
+}
+
+// NewDeviceSetManager returns an empty device set manager.
+func NewDeviceSetManager() *DeviceSetManager {
+	return &DeviceSetManager{
+		sets: make(map[string]*DeviceSet),
+	}
+}
+
+// Add registers an existing device set under the given name. It fails if the
+// name is already taken.
+func (m *DeviceSetManager) Add(name string, set *DeviceSet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sets[name]; exists {
+		return fmt.Errorf("devmapper: device set %q already registered", name)
+	}
+	m.sets[name] = set
+	return nil
+}
+
+// GetOrCreate returns the device set registered under name, creating and
+// registering a new one rooted at root with the given options if none exists
+// yet.
+func (m *DeviceSetManager) GetOrCreate(name, root string, doInit bool, options []string, uidMaps, gidMaps []idtools.IDMap) (*DeviceSet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if set, exists := m.sets[name]; exists {
+		return set, nil
+	}
+
+	set, err := NewDeviceSet(root, doInit, options, uidMaps, gidMaps)
+	if err != nil {
+		return nil, err
+	}
+	m.sets[name] = set
+	return set, nil
+}
+
+// Get returns the device set registered under name, or nil if there is none.
+func (m *DeviceSetManager) Get(name string) *DeviceSet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sets[name]
+}
+
+// Names returns the sorted names of all registered device sets.
+func (m *DeviceSetManager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.sets))
+	for name := range m.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Shutdown shuts down every registered device set against its own root,
+// continuing past failures and returning the last error seen.
+func (m *DeviceSetManager) Shutdown() error {
+	m.mu.Lock()
+	sets := make(map[string]*DeviceSet, len(m.sets))
+	for name, set := range m.sets {
+		sets[name] = set
+	}
+	m.mu.Unlock()
+
+	var lastErr error
+	for name, set := range sets {
+		if err := set.Shutdown(set.root); err != nil {
+			lastErr = fmt.Errorf("devmapper: shutdown of device set %q failed: %v", name, err)
+		}
+	}
+	return lastErr
+}
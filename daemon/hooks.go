@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"github.com/docker/docker/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/dockerhooks"
+)
+
+// runPrestartPolicyHooks gives site-provided hooks a chance to veto the
+// container before it is handed to the runtime. Hooks receive the image
+// reference the container was created from and the image ID it resolved to,
+// so policies like "only signed images from registry X" can be enforced
+// outside the daemon. A missing hooks directory disables the mechanism.
+func (daemon *Daemon) runPrestartPolicyHooks(container *container.Container) error {
+	state := dockerhooks.State{
+		ID:          container.ID,
+		ImageName:   container.Config.Image,
+		ImageDigest: container.ImageID.String(),
+	}
+	if container.BaseFS != nil {
+		state.Root = container.BaseFS.Path()
+	}
+
+	extraEnv, err := dockerhooks.PrepareEnv(daemon.configStore.HookEnv)
+	if err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+
+	if err := dockerhooks.RunHooks(dockerhooks.DefaultDir, dockerhooks.PhasePrestartPolicy, state, extraEnv); err != nil {
+		if hookErr, ok := err.(*dockerhooks.HookError); ok && hookErr.Veto {
+			return errdefs.Forbidden(err)
+		}
+		return errdefs.System(err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/errdefs"
@@ -28,6 +29,17 @@ func (e errImageDoesNotExist) NotFound() {}
 func (daemon *Daemon) GetImageIDAndOS(refOrID string) (image.ID, string, error) {
 	ref, err := reference.ParseAnyReference(refOrID)
 	if err != nil {
+		// Reference names must be lowercase, so a mixed-case name never
+		// parses. With the opt-in fallback it is retried lowercased;
+		// stored names are always lowercase, so the retry cannot be
+		// ambiguous.
+		if daemon.configStore.CaseInsensitiveRefs {
+			if lower := strings.ToLower(refOrID); lower != refOrID {
+				if id, os, lowerErr := daemon.GetImageIDAndOS(lower); lowerErr == nil {
+					return id, os, nil
+				}
+			}
+		}
 		return "", "", errdefs.InvalidParameter(err)
 	}
 	namedRef, ok := ref.(reference.Named)
@@ -51,6 +63,17 @@ func (daemon *Daemon) GetImageIDAndOS(refOrID string) (image.ID, string, error)
 		}
 	}
 
+	// The reference store has no entry for this name@digest pair, but
+	// image IDs are content-addressed digests of the configuration, so
+	// the digest may name a local image directly.
+	if canonical, ok := namedRef.(reference.Canonical); ok {
+		id := image.IDFromDigest(canonical.Digest())
+		if img, err := daemon.imageStore.Get(id); err == nil {
+			return id, img.OperatingSystem(), nil
+		}
+		return "", "", errImageDoesNotExist{ref}
+	}
+
 	// Search based on ID
 	if id, err := daemon.imageStore.Search(refOrID); err == nil {
 		img, err := daemon.imageStore.Get(id)
@@ -71,3 +94,20 @@ func (daemon *Daemon) GetImage(refOrID string) (*image.Image, error) {
 	}
 	return daemon.imageStore.Get(imgID)
 }
+
+// ImageNames returns every reference currently pointing at the image
+// referred to by imageID, which may be abbreviated like any other image
+// reference. The slice is empty for an untagged image.
+func (daemon *Daemon) ImageNames(imageID string) ([]string, error) {
+	imgID, _, err := daemon.GetImageIDAndOS(imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := daemon.referenceStore.References(imgID.Digest())
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, reference.FamiliarString(ref))
+	}
+	return names, nil
+}
@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"fmt"
 	"io"
 	"runtime"
 	"strings"
@@ -25,6 +26,10 @@ func (daemon *Daemon) PullImage(ctx context.Context, image, tag, os string, meta
 	// compatibility.
 	image = strings.TrimSuffix(image, ":")
 
+	if daemon.RegistryService.RequiresFullyQualifiedNames() && !registry.IsNameFullyQualified(image) {
+		return errdefs.InvalidParameter(fmt.Errorf("this daemon requires fully qualified image names; specify the registry explicitly (e.g. docker.io/%s)", image))
+	}
+
 	ref, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
 		return errdefs.InvalidParameter(err)
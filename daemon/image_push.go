@@ -1,23 +1,77 @@
 package daemon
 
 import (
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/distribution"
 	progressutils "github.com/docker/docker/distribution/utils"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/registry"
 	"golang.org/x/net/context"
 )
 
+// confirmPushHeader is the meta header a client sets to confirm a push to a
+// registry listed in --push-confirm-registry.
+const confirmPushHeader = "X-Meta-Confirm-Push"
+
+// pushConfirmed returns true if the client confirmed the push via the
+// confirmPushHeader meta header.
+func pushConfirmed(metaHeaders map[string][]string) bool {
+	for _, v := range metaHeaders[confirmPushHeader] {
+		if v == "1" || v == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// digestReferenceError is returned when a push names a digest instead of a
+// tag. It carries the tags currently pointing at that digest locally so the
+// user knows what to push instead.
+type digestReferenceError struct {
+	ref  reference.Canonical
+	tags []string
+}
+
+func (e digestReferenceError) Error() string {
+	msg := fmt.Sprintf("cannot push a digest reference (%s): push requires a tag", reference.FamiliarString(e.ref))
+	if len(e.tags) > 0 {
+		msg += fmt.Sprintf("; the digest is currently tagged as: %s", strings.Join(e.tags, ", "))
+	}
+	return msg
+}
+
+func (digestReferenceError) InvalidParameter() {}
+
 // PushImage initiates a push operation on the repository named localName.
 func (daemon *Daemon) PushImage(ctx context.Context, image, tag string, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
+	if daemon.RegistryService.RequiresFullyQualifiedNames() && !registry.IsNameFullyQualified(image) {
+		return errdefs.InvalidParameter(fmt.Errorf("this daemon requires fully qualified image names; specify the registry explicitly (e.g. docker.io/%s)", image))
+	}
+
 	ref, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
 		return err
 	}
+	if canonical, isCanonical := ref.(reference.Canonical); isCanonical {
+		// Refuse before any network contact, and suggest the tags that
+		// resolve to this digest locally.
+		var tags []string
+		if id, err := daemon.referenceStore.Get(canonical); err == nil {
+			for _, assoc := range daemon.referenceStore.References(id) {
+				if tagged, isTagged := assoc.(reference.NamedTagged); isTagged {
+					tags = append(tags, reference.FamiliarString(tagged))
+				}
+			}
+		}
+		return digestReferenceError{ref: canonical, tags: tags}
+	}
 	if tag != "" {
 		// Push by digest is not supported, so only tags are supported.
 		ref, err = reference.WithTag(ref, tag)
@@ -26,6 +80,10 @@ func (daemon *Daemon) PushImage(ctx context.Context, image, tag string, metaHead
 		}
 	}
 
+	if daemon.RegistryService.RequiresPushConfirmation(reference.Domain(ref)) && !pushConfirmed(metaHeaders) {
+		return errdefs.Forbidden(fmt.Errorf("push to registry %s must be confirmed; retry with the %s header set", reference.Domain(ref), confirmPushHeader))
+	}
+
 	// Include a buffer so that slow client connections don't affect
 	// transfer performance.
 	progressChan := make(chan progress.Progress, 100)
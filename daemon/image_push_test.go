@@ -0,0 +1,30 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/errdefs"
+)
+
+func TestDigestReferenceError(t *testing.T) {
+	named, err := reference.ParseNormalizedNamed("busybox@sha256:e9e3917527bc41bbf29744e1ab3c1a28b77f12e1a8c9a4b4ecf6dcb1ddc19be5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonical := named.(reference.Canonical)
+
+	pushErr := digestReferenceError{ref: canonical}
+	if !errdefs.IsInvalidParameter(pushErr) {
+		t.Error("expected digestReferenceError to be an invalid parameter error")
+	}
+	if !strings.Contains(pushErr.Error(), "push requires a tag") {
+		t.Errorf("expected message to suggest pushing by tag, got %q", pushErr.Error())
+	}
+
+	pushErr = digestReferenceError{ref: canonical, tags: []string{"busybox:latest", "busybox:1.29"}}
+	if !strings.Contains(pushErr.Error(), "busybox:latest, busybox:1.29") {
+		t.Errorf("expected message to list local tags for the digest, got %q", pushErr.Error())
+	}
+}
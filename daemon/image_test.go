@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	refstore "github.com/docker/docker/reference"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestImageDaemon returns a daemon with real image and reference stores
+// backed by a temporary directory, for exercising image lookup.
+func newTestImageDaemon(t *testing.T) (*Daemon, func()) {
+	tmpDir, err := ioutil.TempDir("", "docker-image-test")
+	require.NoError(t, err)
+
+	fsBackend, err := image.NewFSStoreBackend(filepath.Join(tmpDir, "imagedb"))
+	require.NoError(t, err)
+	imageStore, err := image.NewImageStore(fsBackend, map[string]image.LayerGetReleaser{})
+	require.NoError(t, err)
+	referenceStore, err := refstore.NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	require.NoError(t, err)
+
+	d := &Daemon{
+		imageStore:     imageStore,
+		referenceStore: referenceStore,
+	}
+	return d, func() { os.RemoveAll(tmpDir) }
+}
+
+func TestGetImageIDAndOSByDigest(t *testing.T) {
+	d, cleanup := newTestImageDaemon(t)
+	defer cleanup()
+
+	id, err := d.imageStore.Create([]byte(`{"comment": "abc", "rootfs": {"type": "layers"}}`))
+	require.NoError(t, err)
+
+	// A name@digest reference recorded in the reference store resolves
+	// through it.
+	named, err := reference.ParseNormalizedNamed("busybox")
+	require.NoError(t, err)
+	canonical, err := reference.WithDigest(named, id.Digest())
+	require.NoError(t, err)
+	require.NoError(t, d.referenceStore.AddDigest(canonical, id.Digest(), false))
+
+	resolved, _, err := d.GetImageIDAndOS(reference.FamiliarString(canonical))
+	assert.NoError(t, err)
+	assert.Equal(t, id, resolved)
+
+	// A name@digest reference that was never recorded still resolves when
+	// the digest names a local image ID.
+	otherName, err := reference.ParseNormalizedNamed("unrelated/name")
+	require.NoError(t, err)
+	otherRef, err := reference.WithDigest(otherName, id.Digest())
+	require.NoError(t, err)
+
+	resolved, _, err = d.GetImageIDAndOS(reference.FamiliarString(otherRef))
+	assert.NoError(t, err)
+	assert.Equal(t, id, resolved)
+}
+
+func TestGetImageIDAndOSByDigestNotFound(t *testing.T) {
+	d, cleanup := newTestImageDaemon(t)
+	defer cleanup()
+
+	_, _, err := d.GetImageIDAndOS("busybox@sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	assert.Error(t, err)
+	assert.True(t, errdefs.IsNotFound(err))
+}
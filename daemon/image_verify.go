@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// layerGetReleaser is the subset of layer.Store used to verify layers.
+type layerGetReleaser interface {
+	Get(layer.ChainID) (layer.Layer, error)
+	Release(layer.Layer) ([]layer.Metadata, error)
+}
+
+// VerifyImage recomputes the diff IDs of the layers referenced by an image
+// and compares them against the IDs recorded in the image configuration,
+// detecting on-disk layer corruption. The image configuration itself is
+// content-addressed by its ID, so only the layer data needs rehashing.
+func (daemon *Daemon) VerifyImage(imageRef string) error {
+	img, err := daemon.GetImage(imageRef)
+	if err != nil {
+		return err
+	}
+	return verifyRootFS(daemon.layerStores[img.OperatingSystem()], img.RootFS)
+}
+
+// verifyRootFS rehashes each layer in the rootfs and compares the result with
+// the diff ID the image configuration was created with.
+func verifyRootFS(ls layerGetReleaser, rootFS *image.RootFS) error {
+	for i, diffID := range rootFS.DiffIDs {
+		chainID := layer.CreateChainID(rootFS.DiffIDs[:i+1])
+		l, err := ls.Get(chainID)
+		if err != nil {
+			return fmt.Errorf("layer %s: %v", diffID, err)
+		}
+		computed, err := computeDiffID(l)
+		if _, rerr := ls.Release(l); rerr != nil {
+			logrus.Errorf("Error releasing layer %s: %v", chainID, rerr)
+		}
+		if err != nil {
+			return fmt.Errorf("layer %s: %v", diffID, err)
+		}
+		if computed != diffID {
+			return fmt.Errorf("layer %s: computed diff ID %s does not match", diffID, computed)
+		}
+	}
+	return nil
+}
+
+func computeDiffID(l layer.Layer) (layer.DiffID, error) {
+	ts, err := l.TarStream()
+	if err != nil {
+		return "", err
+	}
+	defer ts.Close()
+
+	digester := digest.Canonical.Digester()
+	if _, err := io.Copy(digester.Hash(), ts); err != nil {
+		return "", err
+	}
+	return layer.DiffID(digester.Digest()), nil
+}
@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/opencontainers/go-digest"
+)
+
+type verifyTestLayer struct {
+	content []byte
+	diffID  layer.DiffID
+	chainID layer.ChainID
+}
+
+func (l *verifyTestLayer) TarStream() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(l.content)), nil
+}
+
+func (l *verifyTestLayer) TarStreamFrom(layer.ChainID) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (l *verifyTestLayer) ChainID() layer.ChainID { return l.chainID }
+
+func (l *verifyTestLayer) DiffID() layer.DiffID { return l.diffID }
+
+func (l *verifyTestLayer) Parent() layer.Layer { return nil }
+
+func (l *verifyTestLayer) Size() (int64, error) { return int64(len(l.content)), nil }
+
+func (l *verifyTestLayer) DiffSize() (int64, error) { return int64(len(l.content)), nil }
+
+func (l *verifyTestLayer) Metadata() (map[string]string, error) { return nil, nil }
+
+type verifyTestStore struct {
+	layers map[layer.ChainID]*verifyTestLayer
+}
+
+func (s *verifyTestStore) Get(chainID layer.ChainID) (layer.Layer, error) {
+	l, ok := s.layers[chainID]
+	if !ok {
+		return nil, layer.ErrLayerDoesNotExist
+	}
+	return l, nil
+}
+
+func (s *verifyTestStore) Release(layer.Layer) ([]layer.Metadata, error) {
+	return nil, nil
+}
+
+func verifyTestRootFS(contents ...[]byte) (*verifyTestStore, *image.RootFS) {
+	store := &verifyTestStore{layers: make(map[layer.ChainID]*verifyTestLayer)}
+	rootFS := image.NewRootFS()
+	for _, content := range contents {
+		diffID := layer.DiffID(digest.FromBytes(content))
+		rootFS.Append(diffID)
+		chainID := layer.CreateChainID(rootFS.DiffIDs)
+		store.layers[chainID] = &verifyTestLayer{
+			content: content,
+			diffID:  diffID,
+			chainID: chainID,
+		}
+	}
+	return store, rootFS
+}
+
+func TestVerifyRootFS(t *testing.T) {
+	store, rootFS := verifyTestRootFS([]byte("first layer"), []byte("second layer"))
+
+	if err := verifyRootFS(store, rootFS); err != nil {
+		t.Fatalf("expected layers to verify, got: %v", err)
+	}
+
+	// Corrupt the content of the second layer without touching its diff ID.
+	store.layers[layer.CreateChainID(rootFS.DiffIDs)].content = []byte("corrupted")
+
+	if err := verifyRootFS(store, rootFS); err == nil {
+		t.Fatal("expected verification of a corrupted layer to fail")
+	}
+}
+
+func TestVerifyRootFSMissingLayer(t *testing.T) {
+	store, rootFS := verifyTestRootFS([]byte("first layer"))
+	delete(store.layers, layer.CreateChainID(rootFS.DiffIDs))
+
+	if err := verifyRootFS(store, rootFS); err == nil {
+		t.Fatal("expected verification of a missing layer to fail")
+	}
+}
@@ -1,8 +1,11 @@
 package daemon
 
 import (
+	"archive/tar"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"runtime"
@@ -26,8 +29,11 @@ import (
 // ImportImage imports an image, getting the archived layer data either from
 // inConfig (if src is "-"), or from a URI specified in src. Progress output is
 // written to outStream. Repository and tag names can optionally be given in
-// the repo and tag arguments, respectively.
-func (daemon *Daemon) ImportImage(src string, repository, os string, tag string, msg string, inConfig io.ReadCloser, outStream io.Writer, changes []string) error {
+// the repo and tag arguments, respectively. Labels of the form key=value are
+// applied to the image configuration so imported images can carry provenance
+// metadata. If dryRun is set, the source is downloaded and validated but no
+// image is created.
+func (daemon *Daemon) ImportImage(src string, repository, os string, tag string, msg string, inConfig io.ReadCloser, outStream io.Writer, changes []string, labels []string, dryRun bool) error {
 	var (
 		rc     io.ReadCloser
 		resp   *http.Response
@@ -54,6 +60,11 @@ func (daemon *Daemon) ImportImage(src string, repository, os string, tag string,
 			if err != nil {
 				return errdefs.InvalidParameter(err)
 			}
+		} else {
+			// Default to :latest when a repository is given without a
+			// tag, consistent with pull and tag. Importing with no
+			// repository at all still produces an untagged image.
+			newRef = reference.TagNameOnly(newRef)
 		}
 	}
 
@@ -61,6 +72,9 @@ func (daemon *Daemon) ImportImage(src string, repository, os string, tag string,
 	if err != nil {
 		return err
 	}
+	if err := applyImportLabels(config, labels); err != nil {
+		return err
+	}
 	if src == "-" {
 		rc = inConfig
 	} else {
@@ -91,6 +105,9 @@ func (daemon *Daemon) ImportImage(src string, repository, os string, tag string,
 	if err != nil {
 		return err
 	}
+	if dryRun {
+		return validateImportSource(inflatedLayerData, outStream)
+	}
 	l, err := daemon.layerStores[os].Register(inflatedLayerData, "")
 	if err != nil {
 		return err
@@ -136,3 +153,48 @@ func (daemon *Daemon) ImportImage(src string, repository, os string, tag string,
 	outStream.Write(streamformatter.FormatStatus("", id.String()))
 	return nil
 }
+
+// applyImportLabels merges key=value label entries into the image
+// configuration, overriding any labels with the same key coming from the
+// Dockerfile changes.
+func applyImportLabels(config *container.Config, labels []string) error {
+	for _, label := range labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errdefs.InvalidParameter(fmt.Errorf("invalid label %q: labels must be of the form key=value", label))
+		}
+		if config.Labels == nil {
+			config.Labels = map[string]string{}
+		}
+		config.Labels[parts[0]] = parts[1]
+	}
+	return nil
+}
+
+// validateImportSource reads the decompressed source to the end, verifying
+// that it is a well-formed tar archive, and reports its uncompressed size and
+// entry count. Nothing is registered or tagged.
+func validateImportSource(layerData io.Reader, outStream io.Writer) error {
+	var (
+		entries int
+		size    int64
+	)
+	tr := tar.NewReader(layerData)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errdefs.InvalidParameter(errors.Wrap(err, "import source is not a valid tar archive"))
+		}
+		n, err := io.Copy(ioutil.Discard, tr)
+		if err != nil {
+			return errdefs.InvalidParameter(errors.Wrapf(err, "error reading %s from import source", hdr.Name))
+		}
+		size += n
+		entries++
+	}
+	outStream.Write(streamformatter.FormatStatus("", "Dry run: valid tar source, %d entries, %d bytes uncompressed", entries, size))
+	return nil
+}
@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+)
+
+func TestValidateImportSource(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	content := []byte("hello world")
+	if err := tw.WriteHeader(&tar.Header{Name: "hello.txt", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := validateImportSource(buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1 entries") || !strings.Contains(out.String(), "11 bytes") {
+		t.Errorf("expected dry-run report with entry and byte counts, got %q", out.String())
+	}
+
+	out.Reset()
+	err := validateImportSource(strings.NewReader("this is not a tar archive"), out)
+	if err == nil {
+		t.Fatal("expected invalid source to be rejected")
+	}
+	if !errdefs.IsInvalidParameter(err) {
+		t.Errorf("expected invalid parameter error, got %v", err)
+	}
+}
+
+func TestApplyImportLabels(t *testing.T) {
+	config := &container.Config{}
+	if err := applyImportLabels(config, []string{"source=backup", "build.id=42"}); err != nil {
+		t.Fatal(err)
+	}
+	if config.Labels["source"] != "backup" || config.Labels["build.id"] != "42" {
+		t.Errorf("expected labels to be applied, got %v", config.Labels)
+	}
+
+	for _, invalid := range []string{"novalue", "=value"} {
+		if err := applyImportLabels(&container.Config{}, []string{invalid}); err == nil {
+			t.Errorf("expected label %q to be rejected", invalid)
+		} else if !errdefs.IsInvalidParameter(err) {
+			t.Errorf("expected invalid parameter error for %q, got %v", invalid, err)
+		}
+	}
+}
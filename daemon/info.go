@@ -21,6 +21,7 @@ import (
 	"github.com/docker/docker/registry"
 	"github.com/docker/docker/volume/drivers"
 	"github.com/docker/go-connections/sockets"
+	units "github.com/docker/go-units"
 	"github.com/sirupsen/logrus"
 )
 
@@ -82,6 +83,12 @@ func (daemon *Daemon) SystemInfo() (*types.Info, error) {
 	drivers := ""
 	for os, gd := range daemon.graphDrivers {
 		ds = append(ds, daemon.layerStores[os].DriverStatus()...)
+		if stats := daemon.layerStores[os].DedupStats(); stats.BytesWritten != 0 || stats.BytesDeduped != 0 {
+			ds = append(ds,
+				[2]string{"Layer Bytes Written", units.HumanSize(float64(stats.BytesWritten))},
+				[2]string{"Layer Bytes Deduplicated", units.HumanSize(float64(stats.BytesDeduped))},
+			)
+		}
 		drivers += gd
 		if len(daemon.graphDrivers) > 1 {
 			drivers += fmt.Sprintf(" (%s) ", os)
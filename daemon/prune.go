@@ -251,19 +251,8 @@ deleteImagesLoop:
 		deletedImages := []types.ImageDeleteResponseItem{}
 		refs := daemon.referenceStore.References(dgst)
 		if len(refs) > 0 {
-			shouldDelete := !danglingOnly
-			if !shouldDelete {
-				hasTag := false
-				for _, ref := range refs {
-					if _, ok := ref.(reference.NamedTagged); ok {
-						hasTag = true
-						break
-					}
-				}
-
-				// Only delete if it's untagged (i.e. repo:<none>)
-				shouldDelete = !hasTag
-			}
+			// Only delete if it's untagged (i.e. repo:<none>)
+			shouldDelete := !danglingOnly || isDanglingImage(refs)
 
 			if shouldDelete {
 				for _, ref := range refs {
@@ -435,6 +424,21 @@ func (daemon *Daemon) NetworksPrune(ctx context.Context, pruneFilters filters.Ar
 	return rep, nil
 }
 
+// isDanglingImage reports whether an image with the given references may be
+// removed by a dangling-only prune. An image is dangling when none of its
+// references is a tag; digest-only references (repo@digest, shown as
+// repo:<none>) do not keep it alive. Images that are untagged but still
+// referenced as a parent or by a container never reach this check, since
+// those are filtered out before deletion.
+func isDanglingImage(refs []reference.Named) bool {
+	for _, ref := range refs {
+		if _, ok := ref.(reference.NamedTagged); ok {
+			return false
+		}
+	}
+	return true
+}
+
 func getUntilFromPruneFilters(pruneFilters filters.Args) (time.Time, error) {
 	until := time.Time{}
 	if !pruneFilters.Contains("until") {
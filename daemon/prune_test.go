@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/docker/distribution/reference"
+)
+
+func TestIsDanglingImage(t *testing.T) {
+	tagged, err := reference.ParseNormalizedNamed("busybox:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonical, err := reference.ParseNormalizedNamed("busybox@sha256:e9e3917527bc41bbf29744e1ab3c1a28b77f12e1a8c9a4b4ecf6dcb1ddc19be5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isDanglingImage(nil) {
+		t.Error("expected an image with no references to be dangling")
+	}
+	if !isDanglingImage([]reference.Named{canonical}) {
+		t.Error("expected an image with only digest references to be dangling")
+	}
+	if isDanglingImage([]reference.Named{tagged}) {
+		t.Error("expected a tagged image not to be dangling")
+	}
+	if isDanglingImage([]reference.Named{canonical, tagged}) {
+		t.Error("expected an image with any tag not to be dangling")
+	}
+}
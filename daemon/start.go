@@ -155,6 +155,10 @@ func (daemon *Daemon) containerStart(container *container.Container, checkpoint
 		return errdefs.System(err)
 	}
 
+	if err := daemon.runPrestartPolicyHooks(container); err != nil {
+		return err
+	}
+
 	if resetRestartManager {
 		container.ResetRestartManager(true)
 	}
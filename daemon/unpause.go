@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/docker/docker/container"
+	"github.com/docker/docker/errdefs"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,7 +25,7 @@ func (daemon *Daemon) containerUnpause(container *container.Container) error {
 
 	// We cannot unpause the container which is not paused
 	if !container.Paused {
-		return fmt.Errorf("Container %s is not paused", container.ID)
+		return errdefs.Conflict(fmt.Errorf("Container %s is not paused", container.ID))
 	}
 
 	if err := daemon.containerd.Resume(context.Background(), container.ID); err != nil {
@@ -115,6 +115,10 @@ func (daemon *Daemon) registerMountPoints(container *container.Container, hostCo
 			return err
 		}
 
+		if err := checkVolumesFromCycle(parser, daemon.GetContainer, container, c); err != nil {
+			return err
+		}
+
 		for _, m := range c.MountPoints {
 			cp := &volume.MountPoint{
 				Type:        m.Type,
@@ -235,6 +239,47 @@ func (daemon *Daemon) registerMountPoints(container *container.Container, hostCo
 	return nil
 }
 
+// checkVolumesFromCycle walks the volumes-from chain starting at source and
+// returns an error when it leads back to ctr. Chains are resolved one level
+// at a time when a container is created, so a cycle can only be built by
+// removing and recreating a container under a name an existing chain still
+// refers to; without this check it surfaces later as confusing
+// duplicate-mount errors.
+func checkVolumesFromCycle(parser volume.Parser, lookup func(string) (*container.Container, error), ctr, source *container.Container) error {
+	if source.ID == ctr.ID {
+		return errdefs.InvalidParameter(fmt.Errorf("volumes-from cycle detected: container %s refers to itself", ctr.ID))
+	}
+
+	visited := map[string]bool{source.ID: true}
+	queue := []*container.Container{source}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if c.HostConfig == nil {
+			continue
+		}
+		for _, spec := range c.HostConfig.VolumesFrom {
+			fromID, _, err := parser.ParseVolumesFrom(spec)
+			if err != nil {
+				continue
+			}
+			next, err := lookup(fromID)
+			if err != nil || next == nil {
+				continue
+			}
+			if next.ID == ctr.ID {
+				return errdefs.InvalidParameter(fmt.Errorf("volumes-from cycle detected: container %s refers back to %s", c.ID, ctr.ID))
+			}
+			if visited[next.ID] {
+				continue
+			}
+			visited[next.ID] = true
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
 // lazyInitializeVolume initializes a mountpoint's volume if needed.
 // This happens after a daemon restart.
 func (daemon *Daemon) lazyInitializeVolume(containerID string, m *volume.MountPoint) error {
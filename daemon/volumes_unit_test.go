@@ -1,9 +1,12 @@
 package daemon
 
 import (
+	"fmt"
 	"runtime"
 	"testing"
 
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/container"
 	"github.com/docker/docker/volume"
 )
 
@@ -40,3 +43,45 @@ func TestParseVolumesFrom(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckVolumesFromCycle(t *testing.T) {
+	newContainer := func(id string, volumesFrom ...string) *container.Container {
+		c := container.NewBaseContainer(id, "")
+		c.HostConfig = &containertypes.HostConfig{VolumesFrom: volumesFrom}
+		return c
+	}
+
+	a := newContainer("a", "b")
+	b := newContainer("b", "a")
+	c := newContainer("c")
+	containers := map[string]*container.Container{"a": a, "b": b, "c": c}
+	lookup := func(id string) (*container.Container, error) {
+		if ctr, ok := containers[id]; ok {
+			return ctr, nil
+		}
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+
+	parser := volume.NewParser(runtime.GOOS)
+
+	// Two containers referencing each other form a cycle, directly or
+	// through an intermediate container.
+	if err := checkVolumesFromCycle(parser, lookup, a, b); err == nil {
+		t.Fatal("expected an error for a cycle between two containers")
+	}
+	d := newContainer("d", "a")
+	containers["d"] = d
+	if err := checkVolumesFromCycle(parser, lookup, b, d); err == nil {
+		t.Fatal("expected an error for a cycle through an intermediate container")
+	}
+
+	// Self-reference is a cycle too.
+	if err := checkVolumesFromCycle(parser, lookup, a, a); err == nil {
+		t.Fatal("expected an error for a self-referencing container")
+	}
+
+	// A chain without a cycle passes.
+	if err := checkVolumesFromCycle(parser, lookup, a, c); err != nil {
+		t.Fatalf("expected no error for an acyclic chain, got %v", err)
+	}
+}
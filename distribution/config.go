@@ -62,6 +62,11 @@ type ImagePullConfig struct {
 	// OS is the requested operating system of the image being pulled to ensure it can be validated
 	// when the host OS supports multiple image operating systems.
 	OS string
+	// IfNewer makes the pull a no-op when the local tag already points at
+	// the image the registry serves for it, skipping the pull entirely.
+	// It has no effect on v1 endpoints, which have no content digests to
+	// compare.
+	IfNewer bool
 }
 
 // ImagePushConfig stores push configuration.
@@ -197,6 +197,26 @@ func (invalidManifestFormatError) Error() string {
 
 func (invalidManifestFormatError) InvalidParameter() {}
 
+// registryBlockedError is returned before any connection is attempted when
+// the daemon is configured to refuse contact with a registry.
+type registryBlockedError string
+
+func (e registryBlockedError) Error() string {
+	return fmt.Sprintf("registry %s is blocked by daemon configuration (--block-registry)", string(e))
+}
+
+func (e registryBlockedError) Forbidden() {}
+
+// readOnlyRegistryError is returned when a push targets a registry that the
+// daemon is configured to treat as read-only.
+type readOnlyRegistryError string
+
+func (e readOnlyRegistryError) Error() string {
+	return fmt.Sprintf("registry %s is configured read-only by daemon configuration (--registry-readonly)", string(e))
+}
+
+func (e readOnlyRegistryError) Forbidden() {}
+
 type reservedNameError string
 
 func (e reservedNameError) Error() string {
@@ -83,3 +83,12 @@ func TestContinueOnError_UnnestsErrors(t *testing.T) {
 		t.Fatal("ContinueOnError should unnest, base return value on errcode.Errors")
 	}
 }
+
+func TestRegistryBlockedError(t *testing.T) {
+	err := registryBlockedError("blocked.example.com")
+
+	expected := "registry blocked.example.com is blocked by daemon configuration (--block-registry)"
+	if err.Error() != expected {
+		t.Fatalf("expected %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,161 @@
+package distribution
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/docker/docker/dockerversion"
+	"github.com/docker/docker/registry"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// RepositoryExists checks whether the repository referenced by ref exists on
+// any of the configured registry endpoints. Unlike a pull, it only probes the
+// repository (the v2 tags list, or the v1 repository data), and maps the
+// registry's "not found" responses to a clean false instead of a hard error.
+// The endpoints are probed concurrently and the first answer wins; fallback
+// errors are discarded so a fast failure does not beat a slower success.
+func RepositoryExists(ctx context.Context, ref reference.Named, config *Config) (bool, error) {
+	repoInfo, err := config.RegistryService.ResolveRepository(ref)
+	if err != nil {
+		return false, err
+	}
+
+	if err := ValidateRepoName(repoInfo.Name); err != nil {
+		return false, err
+	}
+
+	endpoints, err := config.RegistryService.LookupPullEndpoints(reference.Domain(repoInfo.Name))
+	if err != nil {
+		return false, err
+	}
+
+	// Cancelling the context once an answer is in abandons the probes still
+	// in flight.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type existsResult struct {
+		exists bool
+		err    error
+	}
+	results := make(chan existsResult, len(endpoints))
+	for _, endpoint := range endpoints {
+		go func(endpoint registry.APIEndpoint) {
+			logrus.Debugf("Probing %s for existence at %s %s", reference.FamiliarName(repoInfo.Name), endpoint.URL, endpoint.Version)
+
+			var (
+				exists   bool
+				probeErr error
+			)
+			switch endpoint.Version {
+			case registry.APIVersion2:
+				exists, probeErr = repositoryExistsV2(ctx, repoInfo, endpoint, config)
+			case registry.APIVersion1:
+				exists, probeErr = repositoryExistsV1(ctx, repoInfo, endpoint, config)
+			default:
+				probeErr = fallbackError{err: fmt.Errorf("unknown version %d for registry %s", endpoint.Version, endpoint.URL)}
+			}
+			results <- existsResult{exists: exists, err: probeErr}
+		}(endpoint)
+	}
+
+	var lastErr error
+	for range endpoints {
+		result := <-results
+		if result.err != nil {
+			if fallbackErr, ok := result.err.(fallbackError); ok {
+				logrus.Infof("Discarding endpoint error during existence check: %v", fallbackErr.err)
+				lastErr = fallbackErr.err
+				continue
+			}
+			return false, result.err
+		}
+		return result.exists, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no endpoints found for %s", reference.FamiliarString(ref))
+	}
+	return false, lastErr
+}
+
+// repositoryExistsV2 probes a v2 endpoint by requesting the repository's tag
+// list. A repository with no tags still answers the request, so an empty list
+// counts as existing.
+func repositoryExistsV2(ctx context.Context, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint, config *Config) (bool, error) {
+	repo, _, err := NewV2Repository(ctx, repoInfo, endpoint, config.MetaHeaders, config.AuthConfig, "pull")
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := repo.Tags(ctx).All(ctx); err != nil {
+		if v2RepositoryNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// repositoryExistsV1 probes a v1 endpoint with the repository-data call used
+// at the start of a v1 pull, mapping its 404 response to false.
+func repositoryExistsV1(ctx context.Context, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint, config *Config) (bool, error) {
+	tlsConfig, err := config.RegistryService.TLSConfig(repoInfo.Index.Name)
+	if err != nil {
+		return false, err
+	}
+	// Adds Docker-specific headers as well as user-specified headers (metaHeaders)
+	tr := transport.NewTransport(
+		registry.NewTransport(tlsConfig),
+		registry.Headers(dockerversion.DockerUserAgent(ctx), config.MetaHeaders)...,
+	)
+	client := registry.HTTPClient(tr)
+	v1Endpoint := endpoint.ToV1Endpoint(dockerversion.DockerUserAgent(ctx), config.MetaHeaders)
+	session, err := registry.NewSession(client, config.AuthConfig, v1Endpoint)
+	if err != nil {
+		return false, fallbackError{err: err}
+	}
+
+	if _, err := session.GetRepositoryData(repoInfo.Name); err != nil {
+		if v1RepositoryNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// v2RepositoryNotFound returns true if err is a v2 registry response
+// indicating that the repository does not exist (or that access was denied,
+// which is how public registries answer for unknown private repositories).
+func v2RepositoryNotFound(err error) bool {
+	switch v := err.(type) {
+	case errcode.Errors:
+		if len(v) == 0 {
+			return false
+		}
+		return v2RepositoryNotFound(v[0])
+	case errcode.Error:
+		switch v.Code {
+		case v2.ErrorCodeNameUnknown, errcode.ErrorCodeDenied:
+			return true
+		}
+	}
+	return false
+}
+
+// v1RepositoryNotFound returns true if err is a v1 repository-data response
+// indicating that the repository does not exist.
+func v1RepositoryNotFound(err error) bool {
+	if err == registry.ErrRepoNotFound {
+		return true
+	}
+	// The v1 session surfaces HTTP errors as strings; see v1Puller.pullRepository.
+	return strings.Contains(err.Error(), "HTTP code: 404")
+}
@@ -0,0 +1,51 @@
+package distribution
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/docker/registry"
+)
+
+func TestV2RepositoryNotFound(t *testing.T) {
+	notFound := []error{
+		errcode.Error{Code: v2.ErrorCodeNameUnknown},
+		errcode.Error{Code: errcode.ErrorCodeDenied},
+		errcode.Errors{errcode.Error{Code: v2.ErrorCodeNameUnknown}},
+	}
+	for _, err := range notFound {
+		if !v2RepositoryNotFound(err) {
+			t.Errorf("expected not-found for %T: '%s'", err, err.Error())
+		}
+	}
+
+	hardErrors := []error{
+		errcode.Error{Code: errcode.ErrorCodeUnauthorized},
+		errcode.Error{Code: errcode.ErrorCodeTooManyRequests},
+		errcode.Errors{},
+		errors.New("some totally unexpected error"),
+	}
+	for _, err := range hardErrors {
+		if v2RepositoryNotFound(err) {
+			t.Errorf("expected hard error for %T: '%s'", err, err.Error())
+		}
+	}
+}
+
+func TestV1RepositoryNotFound(t *testing.T) {
+	notFound := []error{
+		registry.ErrRepoNotFound,
+		errors.New("Error: Status 404 trying to pull repository library/foo: \"not found\" (HTTP code: 404)"),
+	}
+	for _, err := range notFound {
+		if !v1RepositoryNotFound(err) {
+			t.Errorf("expected not-found for '%s'", err.Error())
+		}
+	}
+
+	if v1RepositoryNotFound(errors.New("Server error: 500")) {
+		t.Errorf("expected hard error for server failure")
+	}
+}
@@ -63,6 +63,10 @@ func Pull(ctx context.Context, ref reference.Named, imagePullConfig *ImagePullCo
 		return err
 	}
 
+	if imagePullConfig.RegistryService.IsIndexBlocked(repoInfo.Index.Name) {
+		return errors.WithStack(registryBlockedError(repoInfo.Index.Name))
+	}
+
 	endpoints, err := imagePullConfig.RegistryService.LookupPullEndpoints(reference.Domain(repoInfo.Name))
 	if err != nil {
 		return err
@@ -109,6 +113,19 @@ func Pull(ctx context.Context, ref reference.Named, imagePullConfig *ImagePullCo
 
 		logrus.Debugf("Trying to pull %s from %s %s", reference.FamiliarName(repoInfo.Name), endpoint.URL, endpoint.Version)
 
+		if imagePullConfig.IfNewer && endpoint.Version == registry.APIVersion2 && imagePullConfig.ReferenceStore != nil {
+			if taggedRef, ok := ref.(reference.NamedTagged); ok {
+				dgst, err := resolveRemoteDigest(ctx, repoInfo, endpoint, &imagePullConfig.Config, taggedRef.Tag())
+				if err != nil {
+					// Fall through to a normal pull attempt on this endpoint.
+					logrus.Debugf("Could not resolve remote digest for %s: %v", reference.FamiliarString(ref), err)
+				} else if tagUpToDate(imagePullConfig.ReferenceStore, taggedRef, dgst) {
+					writeStatus(reference.FamiliarString(ref), imagePullConfig.ProgressOutput, false)
+					return nil
+				}
+			}
+		}
+
 		puller, err := newPuller(endpoint, repoInfo, imagePullConfig)
 		if err != nil {
 			lastErr = err
@@ -186,6 +203,35 @@ func ValidateRepoName(name reference.Named) error {
 	return nil
 }
 
+// resolveRemoteDigest returns the manifest digest the registry currently
+// serves for a tag, without fetching the manifest itself.
+func resolveRemoteDigest(ctx context.Context, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint, config *Config, tag string) (digest.Digest, error) {
+	repo, _, err := NewV2Repository(ctx, repoInfo, endpoint, config.MetaHeaders, config.AuthConfig, "pull")
+	if err != nil {
+		return "", err
+	}
+	descriptor, err := repo.Tags(ctx).Get(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	return descriptor.Digest, nil
+}
+
+// tagUpToDate returns true if the local tag reference points at the same
+// image ID that the given remote manifest digest is known to resolve to.
+func tagUpToDate(store refstore.Store, ref reference.NamedTagged, dgst digest.Digest) bool {
+	id, err := store.Get(ref)
+	if err != nil {
+		return false
+	}
+	dgstRef, err := reference.WithDigest(reference.TrimNamed(ref), dgst)
+	if err != nil {
+		return false
+	}
+	dgstID, err := store.Get(dgstRef)
+	return err == nil && dgstID == id
+}
+
 func addDigestReference(store refstore.Store, ref reference.Named, dgst digest.Digest, id digest.Digest) error {
 	dgstRef, err := reference.WithDigest(reference.TrimNamed(ref), dgst)
 	if err != nil {
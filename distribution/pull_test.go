@@ -0,0 +1,62 @@
+package distribution
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	refstore "github.com/docker/docker/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestTagUpToDate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tag-store-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store, err := refstore.NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	if err != nil {
+		t.Fatalf("error creating tag store: %v", err)
+	}
+
+	id := digest.Digest("sha256:470022b8af682154f57a2163d030eb369549549cba00edc69e1b99b46bb924d6")
+	remoteDigest := digest.Digest("sha256:ae300ebc4a4f00693702cfb0a5e0b7bc527b353828dc86ad09fb95c8a681b793")
+
+	named, err := reference.ParseNormalizedNamed("busybox:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	taggedRef := named.(reference.NamedTagged)
+
+	// Nothing tagged yet.
+	if tagUpToDate(store, taggedRef, remoteDigest) {
+		t.Fatal("expected untagged reference to be out of date")
+	}
+
+	if err := store.AddTag(taggedRef, id, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tag exists but no digest association yet.
+	if tagUpToDate(store, taggedRef, remoteDigest) {
+		t.Fatal("expected reference without digest association to be out of date")
+	}
+
+	if err := addDigestReference(store, taggedRef, remoteDigest, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if !tagUpToDate(store, taggedRef, remoteDigest) {
+		t.Fatal("expected reference to be up to date")
+	}
+
+	// The registry moved the tag to a new manifest.
+	newDigest := digest.Digest("sha256:6153498b9ac00968d71b66cca4eac37e990b5f9eb50c26877eb8799c8847451b")
+	if tagUpToDate(store, taggedRef, newDigest) {
+		t.Fatal("expected reference to be out of date after remote digest changed")
+	}
+}
@@ -62,6 +62,16 @@ type v2Puller struct {
 	confirmedV2 bool
 }
 
+// mirrorSource returns the endpoint host to attribute downloads to when
+// pulling through a mirror, and the empty string when talking to the
+// registry itself.
+func (p *v2Puller) mirrorSource() string {
+	if p.endpoint.Mirror {
+		return p.endpoint.URL.Host
+	}
+	return ""
+}
+
 func (p *v2Puller) Pull(ctx context.Context, ref reference.Named, os string) (err error) {
 	// TODO(tiborvass): was ReceiveTimeout
 	p.repo, p.confirmedV2, err = NewV2Repository(ctx, p.repoInfo, p.endpoint, p.config.MetaHeaders, p.config.AuthConfig, "pull")
@@ -140,6 +150,9 @@ type v2LayerDescriptor struct {
 	tmpFile           *os.File
 	verifier          digest.Verifier
 	src               distribution.Descriptor
+	// source is the mirror host serving this layer, empty when pulling
+	// from the registry itself.
+	source string
 }
 
 func (ld *v2LayerDescriptor) Key() string {
@@ -231,6 +244,7 @@ func (ld *v2LayerDescriptor) Download(ctx context.Context, progressOutput progre
 	}
 
 	reader := progress.NewProgressReader(ioutils.NewCancelReadCloser(ctx, layerDownload), progressOutput, size-offset, ld.ID(), "Downloading")
+	reader.SetSource(ld.source)
 	defer reader.Close()
 
 	if ld.verifier == nil {
@@ -483,6 +497,7 @@ func (p *v2Puller) pullSchema1(ctx context.Context, ref reference.Reference, unv
 			repoInfo:          p.repoInfo,
 			repo:              p.repo,
 			V2MetadataService: p.V2MetadataService,
+			source:            p.mirrorSource(),
 		}
 
 		descriptors = append(descriptors, layerDescriptor)
@@ -559,6 +574,7 @@ func (p *v2Puller) pullSchema2(ctx context.Context, ref reference.Named, mfst *s
 			repoInfo:          p.repoInfo,
 			V2MetadataService: p.V2MetadataService,
 			src:               d,
+			source:            p.mirrorSource(),
 		}
 
 		descriptors = append(descriptors, layerDescriptor)
@@ -726,7 +742,7 @@ func (p *v2Puller) pullManifestList(ctx context.Context, ref reference.Named, mf
 	manifestMatches := filterManifests(mfstList.Manifests, os)
 
 	if len(manifestMatches) == 0 {
-		errMsg := fmt.Sprintf("no matching manifest for %s/%s in the manifest list entries", os, runtime.GOARCH)
+		errMsg := fmt.Sprintf("no matching manifest for %s/%s in the manifest list entries (available: %s)", os, runtime.GOARCH, formatPlatforms(mfstList.Manifests))
 		logrus.Debugf(errMsg)
 		return "", "", errors.New(errMsg)
 	}
@@ -769,6 +785,24 @@ func (p *v2Puller) pullManifestList(ctx context.Context, ref reference.Named, mf
 	return id, manifestListDigest, err
 }
 
+// formatPlatforms renders the platforms a manifest list offers, for error
+// messages when none of them matches the local platform.
+func formatPlatforms(manifests []manifestlist.ManifestDescriptor) string {
+	var (
+		platforms []string
+		seen      = make(map[string]struct{})
+	)
+	for _, manifestDescriptor := range manifests {
+		platform := manifestDescriptor.Platform.OS + "/" + manifestDescriptor.Platform.Architecture
+		if _, ok := seen[platform]; ok {
+			continue
+		}
+		seen[platform] = struct{}{}
+		platforms = append(platforms, platform)
+	}
+	return strings.Join(platforms, ", ")
+}
+
 func (p *v2Puller) pullSchema2Config(ctx context.Context, dgst digest.Digest) (configJSON []byte, err error) {
 	blobs := p.repo.Blobs(ctx)
 	configJSON, err = blobs.Get(ctx, dgst)
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/internal/testutil"
@@ -181,3 +182,16 @@ func TestValidateManifest(t *testing.T) {
 		t.Fatal("expected validateManifest to fail with digest error")
 	}
 }
+
+func TestFormatPlatforms(t *testing.T) {
+	manifests := []manifestlist.ManifestDescriptor{
+		{Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}},
+		{Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}},
+		{Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "arm64"}},
+		{Platform: manifestlist.PlatformSpec{OS: "windows", Architecture: "amd64"}},
+	}
+	expected := "linux/amd64, linux/arm64, windows/amd64"
+	if formatted := formatPlatforms(manifests); formatted != expected {
+		t.Errorf("expected %q, got %q", expected, formatted)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/docker/docker/distribution/metadata"
 	"github.com/docker/docker/pkg/progress"
 	"github.com/docker/docker/registry"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 )
@@ -64,6 +65,14 @@ func Push(ctx context.Context, ref reference.Named, imagePushConfig *ImagePushCo
 		return err
 	}
 
+	if imagePushConfig.RegistryService.IsIndexBlocked(repoInfo.Index.Name) {
+		return errors.WithStack(registryBlockedError(repoInfo.Index.Name))
+	}
+
+	if imagePushConfig.RegistryService.IsIndexReadOnly(repoInfo.Index.Name) {
+		return errors.WithStack(readOnlyRegistryError(repoInfo.Index.Name))
+	}
+
 	endpoints, err := imagePushConfig.RegistryService.LookupPushEndpoints(reference.Domain(repoInfo.Name))
 	if err != nil {
 		return err
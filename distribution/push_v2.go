@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"runtime"
 	"sort"
 	"strings"
@@ -246,6 +247,12 @@ type v2PushDescriptor struct {
 	remoteDescriptor  distribution.Descriptor
 	// a set of digests whose presence has been checked in a target repository
 	checkedDigests map[digest.Digest]struct{}
+	// resumableUpload holds an upload session left open by a previous
+	// failed Commit, together with the number of bytes the registry
+	// confirmed, so a retried Upload can re-attach to the session instead
+	// of pushing the whole blob again.
+	resumableUpload distribution.BlobWriter
+	resumableOffset int64
 }
 
 func (pd *v2PushDescriptor) Key() string {
@@ -283,6 +290,11 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 	}
 	pd.pushState.Unlock()
 
+	if pd.resumableUpload != nil {
+		logrus.Debugf("Resuming upload of layer %s at offset %d", diffID, pd.resumableOffset)
+		return pd.uploadUsingSession(ctx, progressOutput, diffID, pd.resumableUpload)
+	}
+
 	maxMountAttempts, maxExistenceChecks, checkOtherRepositories := getMaxMountAndExistenceCheckAttempts(pd.layer)
 
 	// Do we have any metadata associated with this layer's DiffID?
@@ -392,7 +404,6 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 			return distribution.Descriptor{}, retryOnError(err)
 		}
 	}
-	defer layerUpload.Close()
 
 	// upload the blob
 	return pd.uploadUsingSession(ctx, progressOutput, diffID, layerUpload)
@@ -416,6 +427,7 @@ func (pd *v2PushDescriptor) uploadUsingSession(
 
 	contentReader, err := pd.layer.Open()
 	if err != nil {
+		pd.cancelResumableUpload(ctx, layerUpload)
 		return distribution.Descriptor{}, retryOnError(err)
 	}
 
@@ -434,22 +446,54 @@ func (pd *v2PushDescriptor) uploadUsingSession(
 	case schema2.MediaTypeLayer:
 	default:
 		reader.Close()
+		pd.cancelResumableUpload(ctx, layerUpload)
 		return distribution.Descriptor{}, fmt.Errorf("unsupported layer media type %s", m)
 	}
 
 	digester := digest.Canonical.Digester()
 	tee := io.TeeReader(reader, digester.Hash())
 
+	// If re-attaching to an open upload session, feed the bytes the
+	// registry already confirmed into the digester without sending them
+	// again. The stream is regenerated in-process, so its prefix matches
+	// what was uploaded before.
+	offset := int64(0)
+	if layerUpload == pd.resumableUpload {
+		offset = pd.resumableOffset
+		if _, err := io.CopyN(ioutil.Discard, tee, offset); err != nil {
+			reader.Close()
+			pd.cancelResumableUpload(ctx, layerUpload)
+			return distribution.Descriptor{}, retryOnError(err)
+		}
+	}
+
 	nn, err := layerUpload.ReadFrom(tee)
 	reader.Close()
 	if err != nil {
+		// The number of bytes the registry kept from the interrupted
+		// request is unknown, so the session cannot be safely reused.
+		pd.cancelResumableUpload(ctx, layerUpload)
 		return distribution.Descriptor{}, retryOnError(err)
 	}
+	nn += offset
 
 	pushDigest := digester.Digest()
 	if _, err := layerUpload.Commit(ctx, distribution.Descriptor{Digest: pushDigest}); err != nil {
-		return distribution.Descriptor{}, retryOnError(err)
+		err = retryOnError(err)
+		if _, isDNR := err.(xfer.DoNotRetry); isDNR {
+			pd.cancelResumableUpload(ctx, layerUpload)
+		} else {
+			// The registry has the complete blob content; keep the
+			// session open so a retry only needs to re-issue the
+			// commit.
+			pd.resumableUpload = layerUpload
+			pd.resumableOffset = nn
+		}
+		return distribution.Descriptor{}, err
 	}
+	layerUpload.Close()
+	pd.resumableUpload = nil
+	pd.resumableOffset = 0
 
 	logrus.Debugf("uploaded layer %s (%s), %d bytes", diffID, pushDigest, nn)
 	progress.Update(progressOutput, pd.ID(), "Pushed")
@@ -676,6 +720,16 @@ func getPathComponents(path string) []string {
 	return strings.Split(path, "/")
 }
 
+// cancelResumableUpload cancels an upload session and drops any resume state
+// referring to it, so the next attempt starts a fresh session.
+func (pd *v2PushDescriptor) cancelResumableUpload(ctx context.Context, layerUpload distribution.BlobWriter) {
+	cancelLayerUpload(ctx, digest.Digest(pd.DiffID()), layerUpload)
+	if layerUpload == pd.resumableUpload {
+		pd.resumableUpload = nil
+		pd.resumableOffset = 0
+	}
+}
+
 func cancelLayerUpload(ctx context.Context, dgst digest.Digest, layerUpload distribution.BlobWriter) {
 	if layerUpload != nil {
 		logrus.Debugf("cancelling upload of blob %s", dgst)
@@ -0,0 +1,403 @@
+package distribution
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/docker/docker/dockerversion"
+	"github.com/docker/docker/registry"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// ListRemoteTagsConfig holds the options for listing the tags a registry
+// serves for a repository.
+type ListRemoteTagsConfig struct {
+	Config
+	// CacheTTL, when positive, keeps results in an in-process cache and
+	// serves repeat requests for the same repository from it until the
+	// window expires. Zero disables caching.
+	CacheTTL time.Duration
+	// PreferV2 tries v2 endpoints before v1 ones. The default prefers v1,
+	// whose tag listing also returns image ids, but on registries where
+	// v1 is deprecated and slow that costs a wasted round-trip.
+	PreferV2 bool
+	// BestEffort queries every endpoint and merges the tags from the ones
+	// that succeeded, instead of stopping at the first success or hard
+	// failure. An error is only returned when every endpoint failed.
+	BestEffort bool
+	// WithDigests asks the endpoints to resolve a content digest for each
+	// tag. v1 registries are not content addressed, so their digests are
+	// computed from the image JSON on a best-effort basis and a tag may be
+	// returned without one.
+	WithDigests bool
+	// WithSizes asks v2 endpoints to fetch each tag's manifest and fill in
+	// Size and LayerCount. This costs an extra round-trip per tag, so it is
+	// off by default.
+	WithSizes bool
+}
+
+// RemoteTag is one tag of a remote repository. Fields beyond Tag are filled
+// in when the endpoint that served the tag can provide them: ImageID only
+// comes from v1 registries, and Digest is best-effort for v1 (see
+// ListRemoteTagsConfig.WithDigests).
+type RemoteTag struct {
+	Tag     string
+	ImageID string
+	Digest  digest.Digest
+	// Size is the sum of the tag's layer sizes in bytes, and LayerCount
+	// the number of layers. Both are only filled in from v2 schema2
+	// manifests when ListRemoteTagsConfig.WithSizes is set.
+	Size       int64
+	LayerCount int
+}
+
+// byTagName sorts remote tags lexically by tag name.
+type byTagName []RemoteTag
+
+func (b byTagName) Len() int           { return len(b) }
+func (b byTagName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byTagName) Less(i, j int) bool { return b[i].Tag < b[j].Tag }
+
+// byAPIVersion sorts endpoints for tag listing: v1 endpoints first by
+// default, since their tag listing also returns image ids, or v2 first when
+// preferV2 is set. Within a version, https is preferred over plain http.
+type byAPIVersion struct {
+	endpoints []registry.APIEndpoint
+	preferV2  bool
+}
+
+func (a byAPIVersion) Len() int      { return len(a.endpoints) }
+func (a byAPIVersion) Swap(i, j int) { a.endpoints[i], a.endpoints[j] = a.endpoints[j], a.endpoints[i] }
+func (a byAPIVersion) Less(i, j int) bool {
+	vi, vj := a.endpoints[i].Version, a.endpoints[j].Version
+	if vi != vj {
+		if a.preferV2 {
+			return vi > vj
+		}
+		return vi < vj
+	}
+	if a.endpoints[i].URL.Scheme == "https" && a.endpoints[j].URL.Scheme != "https" {
+		return true
+	}
+	return false
+}
+
+type remoteTagsCacheEntry struct {
+	tags    []RemoteTag
+	expires time.Time
+}
+
+var (
+	remoteTagsCacheMu sync.Mutex
+	remoteTagsCache   = make(map[string]remoteTagsCacheEntry)
+)
+
+// cachedRemoteTags returns the cached tag list for the repository key, if a
+// fresh one exists.
+func cachedRemoteTags(key string) ([]RemoteTag, bool) {
+	remoteTagsCacheMu.Lock()
+	defer remoteTagsCacheMu.Unlock()
+
+	entry, ok := remoteTagsCache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(remoteTagsCache, key)
+		return nil, false
+	}
+	return entry.tags, true
+}
+
+// storeRemoteTags caches the tag list for the repository key for ttl.
+func storeRemoteTags(key string, tags []RemoteTag, ttl time.Duration) {
+	remoteTagsCacheMu.Lock()
+	defer remoteTagsCacheMu.Unlock()
+
+	remoteTagsCache[key] = remoteTagsCacheEntry{
+		tags:    tags,
+		expires: time.Now().Add(ttl),
+	}
+}
+
+// ListRemoteTags returns the sorted list of tags the configured registry
+// endpoints currently serve for ref's repository. With a positive CacheTTL
+// in config, repeat requests within the window are answered from an
+// in-process cache without contacting the registry.
+func ListRemoteTags(ctx context.Context, ref reference.Named, config *ListRemoteTagsConfig) ([]RemoteTag, error) {
+	repoInfo, err := config.RegistryService.ResolveRepository(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateRepoName(repoInfo.Name); err != nil {
+		return nil, err
+	}
+
+	key := repoInfo.Name.Name()
+	if config.CacheTTL > 0 {
+		if tags, ok := cachedRemoteTags(key); ok {
+			return tags, nil
+		}
+	}
+
+	endpoints, err := config.RegistryService.LookupPullEndpoints(reference.Domain(repoInfo.Name))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byAPIVersion{endpoints: endpoints, preferV2: config.PreferV2})
+
+	var (
+		lastErr error
+		errs    []error
+		tagSet  map[string]RemoteTag
+	)
+	if config.BestEffort {
+		tagSet = make(map[string]RemoteTag)
+	}
+	for _, endpoint := range endpoints {
+		logrus.Debugf("Listing tags for %s at %s %s", reference.FamiliarName(repoInfo.Name), endpoint.URL, endpoint.Version)
+
+		var (
+			tags    []RemoteTag
+			listErr error
+		)
+		switch endpoint.Version {
+		case registry.APIVersion2:
+			tags, listErr = listRemoteTagsV2(ctx, repoInfo, endpoint, config)
+		case registry.APIVersion1:
+			tags, listErr = listRemoteTagsV1(ctx, repoInfo, endpoint, config)
+		default:
+			lastErr = fmt.Errorf("unknown version %d for registry %s", endpoint.Version, endpoint.URL)
+			continue
+		}
+
+		if listErr != nil {
+			if fallbackErr, ok := listErr.(fallbackError); ok {
+				listErr = fallbackErr.err
+			} else if !config.BestEffort {
+				return nil, listErr
+			}
+			logrus.Infof("Attempting next endpoint for tag listing after error: %v", listErr)
+			lastErr = listErr
+			errs = append(errs, listErr)
+			continue
+		}
+
+		if config.BestEffort {
+			for _, tag := range tags {
+				if _, ok := tagSet[tag.Tag]; !ok {
+					tagSet[tag.Tag] = tag
+				}
+			}
+			continue
+		}
+
+		sort.Sort(byTagName(tags))
+		if config.CacheTTL > 0 {
+			storeRemoteTags(key, tags, config.CacheTTL)
+		}
+		return tags, nil
+	}
+
+	// In best-effort mode, return the merged tags as long as at least one
+	// endpoint answered.
+	if config.BestEffort && len(errs) < len(endpoints) {
+		tags := make([]RemoteTag, 0, len(tagSet))
+		for _, tag := range tagSet {
+			tags = append(tags, tag)
+		}
+		sort.Sort(byTagName(tags))
+		if config.CacheTTL > 0 {
+			storeRemoteTags(key, tags, config.CacheTTL)
+		}
+		return tags, nil
+	}
+	if len(errs) > 0 {
+		return nil, combineErrors(errs)
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no endpoints found for %s", reference.FamiliarString(ref))
+	}
+	return nil, lastErr
+}
+
+// combineErrors flattens the per-endpoint errors of a failed best-effort
+// listing into one error.
+func combineErrors(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("all endpoints failed:\n%s", strings.Join(msgs, "\n"))
+}
+
+// listRemoteTagsV2 asks a v2 endpoint for the repository's tag list.
+func listRemoteTagsV2(ctx context.Context, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint, config *ListRemoteTagsConfig) ([]RemoteTag, error) {
+	repo, _, err := NewV2Repository(ctx, repoInfo, endpoint, config.MetaHeaders, config.AuthConfig, "pull")
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := repo.Tags(ctx).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]RemoteTag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, RemoteTag{Tag: name})
+	}
+	if config.WithSizes {
+		if err := fetchTagSizes(ctx, repo, tags); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// tagSizeWorkers bounds the concurrent manifest fetches performed when
+// resolving tag sizes.
+const tagSizeWorkers = 4
+
+// fetchTagSizes fills in Size and LayerCount for each tag by fetching its
+// manifest, spreading the fetches over a bounded worker pool. Tags whose
+// manifest cannot be fetched, or whose manifest format carries no layer
+// sizes, are left untouched. Outstanding fetches are abandoned when ctx is
+// cancelled.
+func fetchTagSizes(ctx context.Context, repo distribution.Repository, tags []RemoteTag) error {
+	manSvc, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan int)
+	workers := tagSizeWorkers
+	if len(tags) < workers {
+		workers = len(tags)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				fetchTagSize(ctx, manSvc, &tags[idx])
+			}
+		}()
+	}
+	for i := range tags {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			close(jobs)
+			wg.Wait()
+			return ctx.Err()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return nil
+}
+
+// fetchTagSize sums the layer sizes of tag's manifest. Manifest lists are
+// resolved to the entry matching the local platform first. Only schema2
+// manifests carry layer sizes; anything else leaves the tag untouched.
+func fetchTagSize(ctx context.Context, manSvc distribution.ManifestService, tag *RemoteTag) {
+	manifest, err := manSvc.Get(ctx, "", distribution.WithTag(tag.Tag))
+	if err != nil {
+		logrus.Debugf("Error fetching manifest for size of tag %s: %v", tag.Tag, err)
+		return
+	}
+
+	if mfstList, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		matches := filterManifests(mfstList.Manifests, runtime.GOOS)
+		if len(matches) == 0 {
+			logrus.Debugf("no matching manifest for %s/%s in the manifest list for tag %s (available: %s)", runtime.GOOS, runtime.GOARCH, tag.Tag, formatPlatforms(mfstList.Manifests))
+			return
+		}
+		manifest, err = manSvc.Get(ctx, matches[0].Digest)
+		if err != nil {
+			logrus.Debugf("Error fetching platform manifest for size of tag %s: %v", tag.Tag, err)
+			return
+		}
+	}
+
+	m, ok := manifest.(*schema2.DeserializedManifest)
+	if !ok {
+		return
+	}
+	tag.LayerCount = len(m.Layers)
+	tag.Size = 0
+	for _, layer := range m.Layers {
+		tag.Size += layer.Size
+	}
+}
+
+// listRemoteTagsV1 asks a v1 endpoint for the repository's tags, using the
+// same repository-data call a v1 pull starts with.
+func listRemoteTagsV1(ctx context.Context, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint, config *ListRemoteTagsConfig) ([]RemoteTag, error) {
+	tlsConfig, err := config.RegistryService.TLSConfig(repoInfo.Index.Name)
+	if err != nil {
+		return nil, err
+	}
+	// Adds Docker-specific headers as well as user-specified headers (metaHeaders)
+	tr := transport.NewTransport(
+		registry.NewTransport(tlsConfig),
+		registry.Headers(dockerversion.DockerUserAgent(ctx), config.MetaHeaders)...,
+	)
+	client := registry.HTTPClient(tr)
+	v1Endpoint := endpoint.ToV1Endpoint(dockerversion.DockerUserAgent(ctx), config.MetaHeaders)
+	session, err := registry.NewSession(client, config.AuthConfig, v1Endpoint)
+	if err != nil {
+		return nil, fallbackError{err: err}
+	}
+
+	repoData, err := session.GetRepositoryData(repoInfo.Name)
+	if err != nil {
+		return nil, err
+	}
+	tagsByName, err := session.GetRemoteTags(repoData.Endpoints, repoInfo.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]RemoteTag, 0, len(tagsByName))
+	for tag, imageID := range tagsByName {
+		remoteTag := RemoteTag{Tag: tag, ImageID: imageID}
+		if config.WithDigests {
+			remoteTag.Digest = v1ImageDigest(session, repoData.Endpoints, imageID)
+		}
+		tags = append(tags, remoteTag)
+	}
+	return tags, nil
+}
+
+// v1ImageDigest computes a content digest for a v1 image from its JSON
+// metadata. v1 registries are not content addressed, so this is best-effort:
+// when no endpoint can serve the image JSON an empty digest is returned.
+func v1ImageDigest(session *registry.Session, endpoints []string, imageID string) digest.Digest {
+	for _, ep := range endpoints {
+		imageJSON, _, err := session.GetRemoteImageJSON(imageID, ep)
+		if err != nil {
+			logrus.Debugf("Error getting image JSON for digest of %s from %s: %v", imageID, ep, err)
+			continue
+		}
+		return digest.FromBytes(imageJSON)
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package distribution
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/registry"
+)
+
+func TestRemoteTagsCache(t *testing.T) {
+	key := "docker.io/library/cachetest"
+
+	if _, ok := cachedRemoteTags(key); ok {
+		t.Fatal("expected no cache entry before storing")
+	}
+
+	storeRemoteTags(key, []RemoteTag{{Tag: "1.0"}, {Tag: "latest"}}, time.Minute)
+	tags, ok := cachedRemoteTags(key)
+	if !ok {
+		t.Fatal("expected a fresh cache entry to be served")
+	}
+	if len(tags) != 2 || tags[0].Tag != "1.0" || tags[1].Tag != "latest" {
+		t.Errorf("unexpected cached tags %v", tags)
+	}
+
+	// An expired entry is dropped rather than served.
+	storeRemoteTags(key, []RemoteTag{{Tag: "stale"}}, -time.Second)
+	if _, ok := cachedRemoteTags(key); ok {
+		t.Error("expected an expired cache entry not to be served")
+	}
+	if _, ok := remoteTagsCache[key]; ok {
+		t.Error("expected the expired entry to be deleted")
+	}
+}
+
+func TestByAPIVersion(t *testing.T) {
+	endpoint := func(version registry.APIVersion, scheme string) registry.APIEndpoint {
+		return registry.APIEndpoint{
+			Version: version,
+			URL:     &url.URL{Scheme: scheme, Host: "registry.example.com"},
+		}
+	}
+	mixed := func() []registry.APIEndpoint {
+		return []registry.APIEndpoint{
+			endpoint(registry.APIVersion2, "http"),
+			endpoint(registry.APIVersion1, "http"),
+			endpoint(registry.APIVersion2, "https"),
+			endpoint(registry.APIVersion1, "https"),
+		}
+	}
+	expect := func(t *testing.T, endpoints []registry.APIEndpoint, order ...registry.APIEndpoint) {
+		for i, want := range order {
+			got := endpoints[i]
+			if got.Version != want.Version || got.URL.Scheme != want.URL.Scheme {
+				t.Errorf("endpoint %d: expected %v %s, got %v %s",
+					i, want.Version, want.URL.Scheme, got.Version, got.URL.Scheme)
+			}
+		}
+	}
+
+	endpoints := mixed()
+	sort.Sort(byAPIVersion{endpoints: endpoints})
+	expect(t, endpoints,
+		endpoint(registry.APIVersion1, "https"),
+		endpoint(registry.APIVersion1, "http"),
+		endpoint(registry.APIVersion2, "https"),
+		endpoint(registry.APIVersion2, "http"),
+	)
+
+	endpoints = mixed()
+	sort.Sort(byAPIVersion{endpoints: endpoints, preferV2: true})
+	expect(t, endpoints,
+		endpoint(registry.APIVersion2, "https"),
+		endpoint(registry.APIVersion2, "http"),
+		endpoint(registry.APIVersion1, "https"),
+		endpoint(registry.APIVersion1, "http"),
+	)
+}
+
+func TestCombineErrors(t *testing.T) {
+	single := errors.New("v2 endpoint unreachable")
+	if err := combineErrors([]error{single}); err != single {
+		t.Errorf("expected a single error to be returned as-is, got %v", err)
+	}
+
+	err := combineErrors([]error{single, errors.New("v1 endpoint unreachable")})
+	if !strings.Contains(err.Error(), "v2 endpoint unreachable") || !strings.Contains(err.Error(), "v1 endpoint unreachable") {
+		t.Errorf("expected combined error to mention every endpoint error, got %v", err)
+	}
+}
+
+func TestByTagName(t *testing.T) {
+	tags := []RemoteTag{{Tag: "latest"}, {Tag: "1.0"}, {Tag: "2.0"}}
+	sort.Sort(byTagName(tags))
+	for i, want := range []string{"1.0", "2.0", "latest"} {
+		if tags[i].Tag != want {
+			t.Errorf("tag %d: expected %s, got %s", i, want, tags[i].Tag)
+		}
+	}
+}
@@ -154,6 +154,10 @@ func (ls *mockLayerStore) DriverName() string {
 	return "mock"
 }
 
+func (ls *mockLayerStore) DedupStats() layer.DedupStats {
+	return layer.DedupStats{}
+}
+
 type mockDownloadDescriptor struct {
 	currentDownloads *int32
 	id               string
@@ -330,6 +334,58 @@ func TestSuccessfulDownload(t *testing.T) {
 	}
 }
 
+func TestConcurrentDownloadsSharedLimit(t *testing.T) {
+	// TODO Windows: Fix this unit text
+	if runtime.GOOS == "windows" {
+		t.Skip("Needs fixing on Windows")
+	}
+
+	layerStore := &mockLayerStore{make(map[layer.ChainID]*mockLayer)}
+	lsMap := make(map[string]layer.Store)
+	lsMap[runtime.GOOS] = layerStore
+	ldm := NewLayerDownloadManager(lsMap, maxDownloadConcurrency, func(m *LayerDownloadManager) { m.waitDuration = time.Millisecond })
+
+	// currentDownloads is shared across both simulated pulls, so the mock
+	// descriptors fail if the daemon-wide limit is exceeded rather than a
+	// per-pull one.
+	var currentDownloads int32
+
+	errChan := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		descriptors := make([]DownloadDescriptor, 0, 4)
+		for j := 0; j < 4; j++ {
+			descriptors = append(descriptors, &mockDownloadDescriptor{
+				currentDownloads: &currentDownloads,
+				id:               fmt.Sprintf("pull%did%d", i, j),
+			})
+		}
+
+		go func(descriptors []DownloadDescriptor) {
+			progressChan := make(chan progress.Progress)
+			progressDone := make(chan struct{})
+			go func() {
+				for range progressChan {
+				}
+				close(progressDone)
+			}()
+
+			_, releaseFunc, err := ldm.Download(context.Background(), *image.NewRootFS(), runtime.GOOS, descriptors, progress.ChanOutput(progressChan))
+			if err == nil {
+				releaseFunc()
+			}
+			close(progressChan)
+			<-progressDone
+			errChan <- err
+		}(descriptors)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil {
+			t.Fatalf("download error: %v", err)
+		}
+	}
+}
+
 func TestCancelledDownload(t *testing.T) {
 	layerStore := &mockLayerStore{make(map[layer.ChainID]*mockLayer)}
 	lsMap := make(map[string]layer.Store)
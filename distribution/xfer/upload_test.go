@@ -2,6 +2,7 @@ package xfer
 
 import (
 	"errors"
+	"fmt"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -104,6 +105,45 @@ func TestSuccessfulUpload(t *testing.T) {
 	<-progressDone
 }
 
+func TestConcurrentUploadsSharedLimit(t *testing.T) {
+	lum := NewLayerUploadManager(maxUploadConcurrency, func(m *LayerUploadManager) { m.waitDuration = time.Millisecond })
+
+	// currentUploads is shared across both simulated pushes, so the mock
+	// descriptors fail if the daemon-wide limit is exceeded rather than a
+	// per-push one.
+	var currentUploads int32
+
+	errChan := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		descriptors := make([]UploadDescriptor, 0, 4)
+		for j := 0; j < 4; j++ {
+			diffID := layer.DiffID(fmt.Sprintf("sha256:%d%d%062d", i, j, 0))
+			descriptors = append(descriptors, &mockUploadDescriptor{currentUploads: &currentUploads, diffID: diffID})
+		}
+
+		go func(descriptors []UploadDescriptor) {
+			progressChan := make(chan progress.Progress)
+			progressDone := make(chan struct{})
+			go func() {
+				for range progressChan {
+				}
+				close(progressDone)
+			}()
+
+			err := lum.Upload(context.Background(), descriptors, progress.ChanOutput(progressChan))
+			close(progressChan)
+			<-progressDone
+			errChan <- err
+		}(descriptors)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil {
+			t.Fatalf("upload error: %v", err)
+		}
+	}
+}
+
 func TestCancelledUpload(t *testing.T) {
 	lum := NewLayerUploadManager(maxUploadConcurrency, func(m *LayerUploadManager) { m.waitDuration = time.Millisecond })
 
@@ -193,6 +193,18 @@ type Store interface {
 	Cleanup() error
 	DriverStatus() [][2]string
 	DriverName() string
+	DedupStats() DedupStats
+}
+
+// DedupStats holds cumulative accounting of layer registration: how many
+// bytes of layer data were written to the store versus skipped because an
+// identical layer was already present.
+type DedupStats struct {
+	// BytesWritten is the total diff size of layers added to the store.
+	BytesWritten uint64
+	// BytesDeduped is the total diff size of registered layers that were
+	// discarded because the resulting chain already existed.
+	BytesDeduped uint64
 }
 
 // DescribableStore represents a layer store capable of storing
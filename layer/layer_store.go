@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"sync"
+	"sync/atomic"
 
 	"github.com/docker/distribution"
 	"github.com/docker/docker/daemon/graphdriver"
@@ -37,6 +38,11 @@ type layerStore struct {
 	mounts map[string]*mountedLayer
 	mountL sync.Mutex
 	os     string
+
+	// cumulative registration accounting, updated atomically to keep the
+	// register hot path cheap
+	bytesWritten uint64
+	bytesDeduped uint64
 }
 
 // StoreOptions are the options used to create a new Store instance
@@ -343,6 +349,7 @@ func (ls *layerStore) registerWithDescriptor(ts io.Reader, parent ChainID, descr
 	defer ls.layerL.Unlock()
 
 	if existingLayer := ls.getWithoutLock(layer.chainID); existingLayer != nil {
+		atomic.AddUint64(&ls.bytesDeduped, uint64(layer.size))
 		// Set error for cleanup, but do not return the error
 		err = errors.New("layer already exists")
 		return existingLayer.getReference(), nil
@@ -352,11 +359,21 @@ func (ls *layerStore) registerWithDescriptor(ts io.Reader, parent ChainID, descr
 		return nil, err
 	}
 
+	atomic.AddUint64(&ls.bytesWritten, uint64(layer.size))
 	ls.layerMap[layer.chainID] = layer
 
 	return layer.getReference(), nil
 }
 
+// DedupStats returns cumulative accounting of how many bytes of layer data
+// were written versus skipped because the layer was already present.
+func (ls *layerStore) DedupStats() DedupStats {
+	return DedupStats{
+		BytesWritten: atomic.LoadUint64(&ls.bytesWritten),
+		BytesDeduped: atomic.LoadUint64(&ls.bytesDeduped),
+	}
+}
+
 func (ls *layerStore) getWithoutLock(layer ChainID) *roLayer {
 	l, ok := ls.layerMap[layer]
 	if !ok {
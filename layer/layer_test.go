@@ -769,3 +769,49 @@ func TestTarStreamVerification(t *testing.T) {
 		t.Fatalf("wrong error returned from tarstream: %q", err)
 	}
 }
+
+func TestRegisterDedupStats(t *testing.T) {
+	// TODO Windows: Figure out why this is failing
+	if runtime.GOOS == "windows" {
+		t.Skip("Failing on Windows")
+	}
+	ls, _, cleanup := newTestStore(t)
+	defer cleanup()
+
+	layer1, err := createLayer(ls, "", initWithFiles(newTestFile("layer1.txt", []byte("layer 1 file"), 0644)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := ls.DedupStats()
+	if stats.BytesWritten == 0 {
+		t.Fatal("expected bytes written to be counted for a new layer")
+	}
+	if stats.BytesDeduped != 0 {
+		t.Fatalf("expected no deduplicated bytes yet, got %d", stats.BytesDeduped)
+	}
+
+	ts, err := layer1.TarStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer2, err := ls.Register(ts, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layer2.ChainID() != layer1.ChainID() {
+		t.Fatalf("expected re-registered layer to deduplicate to %v, got %v", layer1.ChainID(), layer2.ChainID())
+	}
+
+	stats = ls.DedupStats()
+	if stats.BytesDeduped == 0 {
+		t.Fatal("expected deduplicated bytes to be counted for an existing layer")
+	}
+
+	if _, err := ls.Release(layer2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.Release(layer1); err != nil {
+		t.Fatal(err)
+	}
+}
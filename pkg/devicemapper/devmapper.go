@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"unsafe"
 
 	"github.com/sirupsen/logrus"
@@ -445,9 +446,23 @@ func BlockDeviceDiscard(path string) error {
 	return nil
 }
 
+// thinPoolParams builds the thin-pool target parameter line. The
+// skip_block_zeroing feature is always set; extra feature arguments are
+// appended to the feature list.
+func thinPoolParams(metadataName, dataName string, poolBlockSize uint32, features []string) string {
+	featureArgs := append([]string{"skip_block_zeroing"}, features...)
+	return fmt.Sprintf("%s %s %d 32768 %d %s", metadataName, dataName, poolBlockSize, len(featureArgs), strings.Join(featureArgs, " "))
+}
+
 // CreatePool is the programmatic example of "dmsetup create".
 // It creates a device with the specified poolName, data and metadata file and block size.
 func CreatePool(poolName string, dataFile, metadataFile *os.File, poolBlockSize uint32) error {
+	return CreatePoolWithFeatures(poolName, dataFile, metadataFile, poolBlockSize, nil)
+}
+
+// CreatePoolWithFeatures is CreatePool with additional thin-pool feature
+// arguments (such as error_if_no_space) appended to the target line.
+func CreatePoolWithFeatures(poolName string, dataFile, metadataFile *os.File, poolBlockSize uint32, features []string) error {
 	task, err := TaskCreateNamed(deviceCreate, poolName)
 	if task == nil {
 		return err
@@ -458,7 +473,7 @@ func CreatePool(poolName string, dataFile, metadataFile *os.File, poolBlockSize
 		return fmt.Errorf("devicemapper: Can't get data size %s", err)
 	}
 
-	params := fmt.Sprintf("%s %s %d 32768 1 skip_block_zeroing", metadataFile.Name(), dataFile.Name(), poolBlockSize)
+	params := thinPoolParams(metadataFile.Name(), dataFile.Name(), poolBlockSize, features)
 	if err := task.addTarget(0, size/512, "thin-pool", params); err != nil {
 		return fmt.Errorf("devicemapper: Can't add target %s", err)
 	}
@@ -480,6 +495,12 @@ func CreatePool(poolName string, dataFile, metadataFile *os.File, poolBlockSize
 // ReloadPool is the programmatic example of "dmsetup reload".
 // It reloads the table with the specified poolName, data and metadata file and block size.
 func ReloadPool(poolName string, dataFile, metadataFile *os.File, poolBlockSize uint32) error {
+	return ReloadPoolWithFeatures(poolName, dataFile, metadataFile, poolBlockSize, nil)
+}
+
+// ReloadPoolWithFeatures is ReloadPool with additional thin-pool feature
+// arguments appended to the target line.
+func ReloadPoolWithFeatures(poolName string, dataFile, metadataFile *os.File, poolBlockSize uint32, features []string) error {
 	task, err := TaskCreateNamed(deviceReload, poolName)
 	if task == nil {
 		return err
@@ -490,7 +511,7 @@ func ReloadPool(poolName string, dataFile, metadataFile *os.File, poolBlockSize
 		return fmt.Errorf("devicemapper: Can't get data size %s", err)
 	}
 
-	params := fmt.Sprintf("%s %s %d 32768 1 skip_block_zeroing", metadataFile.Name(), dataFile.Name(), poolBlockSize)
+	params := thinPoolParams(metadataFile.Name(), dataFile.Name(), poolBlockSize, features)
 	if err := task.addTarget(0, size/512, "thin-pool", params); err != nil {
 		return fmt.Errorf("devicemapper: Can't add target %s", err)
 	}
@@ -69,26 +69,48 @@ type DefaultLogger struct {
 	// Level corresponds to the highest libdm level that will be forwarded to
 	// logrus. In order to change this, register a new DefaultLogger.
 	Level int
+
+	// Logger, when set, receives the forwarded messages instead of the
+	// logrus standard logger. This allows routing the (very chatty) libdm
+	// output to a separate destination.
+	Logger *logrus.Logger
+}
+
+// dmLogrusLevel maps a libdm log level to the logrus level the message is
+// forwarded at.
+func dmLogrusLevel(level int) logrus.Level {
+	switch level {
+	case LogLevelFatal, LogLevelErr:
+		return logrus.ErrorLevel
+	case LogLevelWarn:
+		return logrus.WarnLevel
+	case LogLevelDebug:
+		return logrus.DebugLevel
+	default:
+		// LogLevelNotice, LogLevelInfo; don't drop any "unknown" levels.
+		return logrus.InfoLevel
+	}
 }
 
 // DMLog is the logging callback containing all of the information from
 // devicemapper. The interface is identical to the C libdm counterpart.
 func (l DefaultLogger) DMLog(level int, file string, line, dmError int, message string) {
 	if level <= l.Level {
+		logger := l.Logger
+		if logger == nil {
+			logger = logrus.StandardLogger()
+		}
 		// Forward the log to the correct logrus level, if allowed by dmLogLevel.
 		logMsg := fmt.Sprintf("libdevmapper(%d): %s:%d (%d) %s", level, file, line, dmError, message)
-		switch level {
-		case LogLevelFatal, LogLevelErr:
-			logrus.Error(logMsg)
-		case LogLevelWarn:
-			logrus.Warn(logMsg)
-		case LogLevelNotice, LogLevelInfo:
-			logrus.Info(logMsg)
-		case LogLevelDebug:
-			logrus.Debug(logMsg)
+		switch dmLogrusLevel(level) {
+		case logrus.ErrorLevel:
+			logger.Error(logMsg)
+		case logrus.WarnLevel:
+			logger.Warn(logMsg)
+		case logrus.DebugLevel:
+			logger.Debug(logMsg)
 		default:
-			// Don't drop any "unknown" levels.
-			logrus.Info(logMsg)
+			logger.Info(logMsg)
 		}
 	}
 }
@@ -0,0 +1,47 @@
+// +build linux,cgo
+
+package devicemapper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestDMLogrusLevel(t *testing.T) {
+	levels := map[int]logrus.Level{
+		LogLevelFatal:  logrus.ErrorLevel,
+		LogLevelErr:    logrus.ErrorLevel,
+		LogLevelWarn:   logrus.WarnLevel,
+		LogLevelNotice: logrus.InfoLevel,
+		LogLevelInfo:   logrus.InfoLevel,
+		LogLevelDebug:  logrus.DebugLevel,
+		// Unknown levels must not be dropped.
+		42: logrus.InfoLevel,
+	}
+	for dmLevel, expected := range levels {
+		if actual := dmLogrusLevel(dmLevel); actual != expected {
+			t.Errorf("libdm level %d: expected logrus level %v, got %v", dmLevel, expected, actual)
+		}
+	}
+}
+
+func TestDefaultLoggerSeparateWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+
+	l := DefaultLogger{Level: LogLevelErr, Logger: logger}
+
+	l.DMLog(LogLevelErr, "ioctl.c", 42, 0, "something broke")
+	if !bytes.Contains(buf.Bytes(), []byte("something broke")) {
+		t.Errorf("expected message in separate writer, got %q", buf.String())
+	}
+
+	buf.Reset()
+	l.DMLog(LogLevelDebug, "ioctl.c", 42, 0, "chatter")
+	if buf.Len() != 0 {
+		t.Errorf("expected message above configured level to be dropped, got %q", buf.String())
+	}
+}
@@ -0,0 +1,167 @@
+// Package dockerhooks runs site-provided hook executables at container
+// lifecycle points. Hooks are dropped into a well-known directory by the
+// administrator and receive a JSON description of the container on stdin,
+// allowing policy to be enforced without modifying the daemon.
+package dockerhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultDir is the directory scanned for hook executables.
+const DefaultDir = "/usr/libexec/docker/hooks.d"
+
+// PhasePrestartPolicy is the phase passed to hooks run before the container
+// is handed to the runtime. A hook may veto the start during this phase.
+const PhasePrestartPolicy = "prestart-policy"
+
+// VetoExitCode is the exit code a hook uses to reject the operation with a
+// structured error. The hook's stderr is reported back to the user as the
+// reason. Any other non-zero exit code is treated as a hook failure.
+const VetoExitCode = 3
+
+// State is the JSON document fed to a hook on stdin. It describes the
+// container the hook is being run for.
+type State struct {
+	// Version is the version of this structure.
+	Version string `json:"version"`
+	// ID is the container ID.
+	ID string `json:"id"`
+	// Root is the path to the container's root filesystem, if mounted.
+	Root string `json:"root,omitempty"`
+	// ImageName is the image reference the container was created from, as
+	// given by the user.
+	ImageName string `json:"imageName,omitempty"`
+	// ImageDigest is the content-addressable digest the image reference
+	// resolved to, allowing hooks to pin policy to exact image content.
+	ImageDigest string `json:"imageDigest,omitempty"`
+}
+
+// CurrentStateVersion is the value of State.Version emitted by this daemon.
+const CurrentStateVersion = "1.0"
+
+// HookError is returned when a hook exits non-zero. Veto reports whether the
+// hook used VetoExitCode to deliberately reject the operation.
+type HookError struct {
+	// Path is the hook executable that failed.
+	Path string
+	// Veto is true if the hook exited with VetoExitCode.
+	Veto bool
+	// Output is the hook's stderr, used as the rejection reason.
+	Output string
+	// Err is the underlying execution error.
+	Err error
+}
+
+func (e *HookError) Error() string {
+	if e.Veto {
+		return fmt.Sprintf("container rejected by hook %s: %s", filepath.Base(e.Path), e.Output)
+	}
+	return fmt.Sprintf("hook %s failed: %v: %s", filepath.Base(e.Path), e.Err, e.Output)
+}
+
+func (e *HookError) Forbidden() {}
+
+// envNameRegexp matches valid environment variable names.
+var envNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// PrepareEnv validates and expands the configured extra hook environment.
+// Each entry must be of the form NAME=value, where NAME is a valid variable
+// name; occurrences of $VAR or ${VAR} in value are expanded from the daemon's
+// own environment. This lets hooks receive site-specific configuration, such
+// as a policy server URL, without hardcoding it in every hook.
+func PrepareEnv(entries []string) ([]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	env := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid hook environment entry %q: must be of the form NAME=value", entry)
+		}
+		if !envNameRegexp.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid hook environment variable name %q", parts[0])
+		}
+		env = append(env, parts[0]+"="+os.ExpandEnv(parts[1]))
+	}
+	return env, nil
+}
+
+// RunHooks runs every executable in dir, in lexical order, for the given
+// phase. Each hook is invoked with the phase as its only argument, the JSON
+// encoding of state on stdin, and an environment containing container=docker,
+// DOCKER_HOOKS_PATH set to dir, and any entries from extraEnv. The first hook
+// that exits non-zero aborts the run and its error is returned. A missing dir
+// is not an error.
+func RunHooks(dir, phase string, state State, extraEnv []string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if state.Version == "" {
+		state.Version = CurrentStateVersion
+	}
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	env := append([]string{
+		"container=docker",
+		"DOCKER_HOOKS_PATH=" + dir,
+	}, extraEnv...)
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && entry.Mode().Perm()&0111 != 0 {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := runHook(filepath.Join(dir, name), phase, stateJSON, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runHook executes a single hook, feeding it stateJSON on stdin.
+func runHook(path, phase string, stateJSON []byte, env []string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, phase)
+	cmd.Stdin = bytes.NewReader(stateJSON)
+	cmd.Stderr = &stderr
+	cmd.Env = env
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	hookErr := &HookError{
+		Path:   path,
+		Output: string(bytes.TrimSpace(stderr.Bytes())),
+		Err:    err,
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(interface{ ExitStatus() int }); ok {
+			hookErr.Veto = status.ExitStatus() == VetoExitCode
+		}
+	}
+	return hookErr
+}
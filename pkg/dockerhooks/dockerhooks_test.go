@@ -0,0 +1,163 @@
+package dockerhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHook(t *testing.T, dir, name, script string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunHooksState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerhooks-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stateFile := filepath.Join(dir, "state.json")
+	argsFile := filepath.Join(dir, "args")
+	writeHook(t, dir, "01-capture", "#!/bin/sh\ncat > "+stateFile+"\necho \"$1\" > "+argsFile+"\n")
+
+	state := State{
+		ID:          "deadbeef",
+		ImageName:   "registry.example.com/foo/bar:latest",
+		ImageDigest: "sha256:e9e3917527bc41bbf29744e1ab3c1a28b77f12e1a8c9a4b4ecf6dcb1ddc19be5",
+	}
+	if err := RunHooks(dir, PhasePrestartPolicy, state, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received State
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatal(err)
+	}
+	if received.Version != CurrentStateVersion {
+		t.Errorf("expected version %q, got %q", CurrentStateVersion, received.Version)
+	}
+	if received.ID != state.ID || received.ImageName != state.ImageName || received.ImageDigest != state.ImageDigest {
+		t.Errorf("hook received unexpected state %+v", received)
+	}
+
+	args, err := ioutil.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(args) != PhasePrestartPolicy+"\n" {
+		t.Errorf("expected phase argument %q, got %q", PhasePrestartPolicy, string(args))
+	}
+}
+
+func TestRunHooksVeto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerhooks-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeHook(t, dir, "01-veto", "#!/bin/sh\necho 'image not signed' >&2\nexit 3\n")
+
+	err = RunHooks(dir, PhasePrestartPolicy, State{ID: "deadbeef"}, nil)
+	if err == nil {
+		t.Fatal("expected hook veto error")
+	}
+	hookErr, ok := err.(*HookError)
+	if !ok {
+		t.Fatalf("expected *HookError, got %T", err)
+	}
+	if !hookErr.Veto {
+		t.Error("expected error to be a veto")
+	}
+	if hookErr.Output != "image not signed" {
+		t.Errorf("expected stderr as reason, got %q", hookErr.Output)
+	}
+}
+
+func TestRunHooksFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerhooks-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeHook(t, dir, "01-fail", "#!/bin/sh\nexit 1\n")
+
+	err = RunHooks(dir, PhasePrestartPolicy, State{ID: "deadbeef"}, nil)
+	if err == nil {
+		t.Fatal("expected hook failure error")
+	}
+	if hookErr, ok := err.(*HookError); !ok || hookErr.Veto {
+		t.Errorf("expected non-veto *HookError, got %#v", err)
+	}
+}
+
+func TestRunHooksMissingDir(t *testing.T) {
+	if err := RunHooks("/nonexistent/hooks.d", PhasePrestartPolicy, State{}, nil); err != nil {
+		t.Fatalf("expected missing directory to be ignored, got %v", err)
+	}
+}
+
+func TestPrepareEnv(t *testing.T) {
+	os.Setenv("DOCKERHOOKS_TEST_PROXY", "http://proxy.example.com")
+	defer os.Unsetenv("DOCKERHOOKS_TEST_PROXY")
+
+	env, err := PrepareEnv([]string{
+		"POLICY_URL=https://policy.example.com",
+		"HTTP_PROXY=${DOCKERHOOKS_TEST_PROXY}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"POLICY_URL=https://policy.example.com",
+		"HTTP_PROXY=http://proxy.example.com",
+	}
+	if len(env) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, env)
+	}
+	for i := range expected {
+		if env[i] != expected[i] {
+			t.Errorf("expected env[%d] to be %q, got %q", i, expected[i], env[i])
+		}
+	}
+
+	for _, invalid := range []string{"NOVALUE", "1BAD=foo", "BAD-NAME=foo"} {
+		if _, err := PrepareEnv([]string{invalid}); err == nil {
+			t.Errorf("expected error for entry %q", invalid)
+		}
+	}
+}
+
+func TestRunHooksExtraEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerhooks-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, "env")
+	writeHook(t, dir, "01-env", "#!/bin/sh\necho \"$POLICY_URL\" > "+envFile+"\n")
+
+	extraEnv := []string{"POLICY_URL=https://policy.example.com"}
+	if err := RunHooks(dir, PhasePrestartPolicy, State{ID: "deadbeef"}, extraEnv); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "https://policy.example.com\n" {
+		t.Errorf("expected extra environment to reach the hook, got %q", string(data))
+	}
+}
@@ -0,0 +1,67 @@
+package jsonmessage
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ProgressEvent is a stable machine-readable representation of a single
+// JSONMessage from a push or pull stream. Unlike JSONMessage, whose rendering
+// is geared towards terminals, its schema is part of the API: Phase carries
+// the status text ("Downloading", "Pushed", ...), ID identifies the layer the
+// event applies to, and Current/Total track transferred bytes.
+type ProgressEvent struct {
+	Phase   string           `json:"phase,omitempty"`
+	ID      string           `json:"id,omitempty"`
+	Current int64            `json:"current,omitempty"`
+	Total   int64            `json:"total,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	Aux     *json.RawMessage `json:"aux,omitempty"`
+}
+
+// NewProgressEvent converts a decoded JSONMessage into its ProgressEvent
+// representation.
+func NewProgressEvent(jm *JSONMessage) ProgressEvent {
+	ev := ProgressEvent{
+		Phase: jm.Status,
+		ID:    jm.ID,
+		Aux:   jm.Aux,
+	}
+	if jm.Progress != nil {
+		ev.Current = jm.Progress.Current
+		ev.Total = jm.Progress.Total
+	}
+	if jm.Error != nil {
+		ev.Error = jm.Error.Message
+	} else if jm.ErrorMessage != "" {
+		ev.Error = jm.ErrorMessage
+	}
+	return ev
+}
+
+// DisplayJSONMessagesAsEvents re-encodes a JSONMessage stream from `in` as
+// one ProgressEvent per line on `out`. It is the machine-readable counterpart
+// of DisplayJSONMessagesStream; an error event terminates the stream the same
+// way an error message does for the human-readable display.
+func DisplayJSONMessagesAsEvents(in io.Reader, out io.Writer) error {
+	dec := json.NewDecoder(in)
+	enc := json.NewEncoder(out)
+
+	for {
+		var jm JSONMessage
+		if err := dec.Decode(&jm); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if err := enc.Encode(NewProgressEvent(&jm)); err != nil {
+			return err
+		}
+
+		if jm.Error != nil {
+			return jm.Error
+		}
+	}
+}
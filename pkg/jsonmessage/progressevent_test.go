@@ -0,0 +1,62 @@
+package jsonmessage
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProgressEvent(t *testing.T) {
+	jm := JSONMessage{
+		ID:       "deadbeef",
+		Status:   "Downloading",
+		Progress: &JSONProgress{Current: 20, Total: 100},
+	}
+	ev := NewProgressEvent(&jm)
+	assert.Equal(t, "Downloading", ev.Phase)
+	assert.Equal(t, "deadbeef", ev.ID)
+	assert.Equal(t, int64(20), ev.Current)
+	assert.Equal(t, int64(100), ev.Total)
+	assert.Equal(t, "", ev.Error)
+
+	jm = JSONMessage{Error: &JSONError{404, "Not found"}}
+	ev = NewProgressEvent(&jm)
+	assert.Equal(t, "Not found", ev.Error)
+}
+
+func TestDisplayJSONMessagesAsEvents(t *testing.T) {
+	in := strings.Join([]string{
+		`{"id":"deadbeef","status":"Downloading","progressDetail":{"current":1,"total":2}}`,
+		`{"id":"deadbeef","status":"Pull complete"}`,
+	}, "\n")
+
+	var out bytes.Buffer
+	err := DisplayJSONMessagesAsEvents(strings.NewReader(in), &out)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var ev ProgressEvent
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &ev))
+	assert.Equal(t, ProgressEvent{Phase: "Downloading", ID: "deadbeef", Current: 1, Total: 2}, ev)
+
+	var ev2 ProgressEvent
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &ev2))
+	assert.Equal(t, ProgressEvent{Phase: "Pull complete", ID: "deadbeef"}, ev2)
+}
+
+func TestDisplayJSONMessagesAsEventsError(t *testing.T) {
+	in := `{"errorDetail":{"code":404,"message":"Not found"},"error":"Not found"}`
+
+	var out bytes.Buffer
+	err := DisplayJSONMessagesAsEvents(strings.NewReader(in), &out)
+	assert.EqualError(t, err, "Not found")
+
+	var ev ProgressEvent
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(out.String())), &ev))
+	assert.Equal(t, "Not found", ev.Error)
+}
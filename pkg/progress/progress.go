@@ -21,6 +21,10 @@ type Progress struct {
 	// If not empty, use units instead of bytes for counts
 	Units string
 
+	// Source identifies the host the data is transferred from, such as
+	// the registry mirror that served a layer.
+	Source string
+
 	// Aux contains extra information not presented to the user, such as
 	// digests for push signing.
 	Aux interface{}
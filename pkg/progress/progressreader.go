@@ -16,6 +16,7 @@ type Reader struct {
 	lastUpdate  int64
 	id          string
 	action      string
+	source      string
 	rateLimiter *rate.Limiter
 }
 
@@ -31,6 +32,12 @@ func NewProgressReader(in io.ReadCloser, out Output, size int64, id, action stri
 	}
 }
 
+// SetSource attaches the host the data is read from to the reader's
+// progress updates, such as the registry mirror serving a layer.
+func (p *Reader) SetSource(source string) {
+	p.source = source
+}
+
 func (p *Reader) Read(buf []byte) (n int, err error) {
 	read, err := p.in.Read(buf)
 	p.current += int64(read)
@@ -61,6 +68,6 @@ func (p *Reader) Close() error {
 
 func (p *Reader) updateProgress(last bool) {
 	if last || p.current == p.size || p.rateLimiter.Allow() {
-		p.out.WriteProgress(Progress{ID: p.id, Action: p.action, Current: p.current, Total: p.size, LastUpdate: last})
+		p.out.WriteProgress(Progress{ID: p.id, Action: p.action, Current: p.current, Total: p.size, Source: p.source, LastUpdate: last})
 	}
 }
@@ -45,7 +45,9 @@ func (sf *jsonProgressFormatter) formatStatus(id, format string, a ...interface{
 }
 
 // formatProgress formats the progress information for a specified action.
-func (sf *jsonProgressFormatter) formatProgress(id, action string, progress *jsonmessage.JSONProgress, aux interface{}) []byte {
+// source, if not empty, identifies the host the data comes from and is
+// emitted in the message's "from" field.
+func (sf *jsonProgressFormatter) formatProgress(id, action string, progress *jsonmessage.JSONProgress, aux interface{}, source string) []byte {
 	if progress == nil {
 		progress = &jsonmessage.JSONProgress{}
 	}
@@ -63,6 +65,7 @@ func (sf *jsonProgressFormatter) formatProgress(id, action string, progress *jso
 		ProgressMessage: progress.String(),
 		Progress:        progress,
 		ID:              id,
+		From:            source,
 		Aux:             auxJSON,
 	})
 	if err != nil {
@@ -77,7 +80,7 @@ func (sf *rawProgressFormatter) formatStatus(id, format string, a ...interface{}
 	return []byte(fmt.Sprintf(format, a...) + streamNewline)
 }
 
-func (sf *rawProgressFormatter) formatProgress(id, action string, progress *jsonmessage.JSONProgress, aux interface{}) []byte {
+func (sf *rawProgressFormatter) formatProgress(id, action string, progress *jsonmessage.JSONProgress, aux interface{}, source string) []byte {
 	if progress == nil {
 		progress = &jsonmessage.JSONProgress{}
 	}
@@ -102,7 +105,7 @@ func NewJSONProgressOutput(out io.Writer, newLines bool) progress.Output {
 
 type formatProgress interface {
 	formatStatus(id, format string, a ...interface{}) []byte
-	formatProgress(id, action string, progress *jsonmessage.JSONProgress, aux interface{}) []byte
+	formatProgress(id, action string, progress *jsonmessage.JSONProgress, aux interface{}, source string) []byte
 }
 
 type progressOutput struct {
@@ -118,7 +121,7 @@ func (out *progressOutput) WriteProgress(prog progress.Progress) error {
 		formatted = out.sf.formatStatus(prog.ID, prog.Message)
 	} else {
 		jsonProgress := jsonmessage.JSONProgress{Current: prog.Current, Total: prog.Total, HideCounts: prog.HideCounts, Units: prog.Units}
-		formatted = out.sf.formatProgress(prog.ID, prog.Action, &jsonProgress, prog.Aux)
+		formatted = out.sf.formatProgress(prog.ID, prog.Action, &jsonProgress, prog.Aux, prog.Source)
 	}
 	_, err := out.out.Write(formatted)
 	if err != nil {
@@ -25,7 +25,7 @@ func TestRawProgressFormatterFormatProgress(t *testing.T) {
 		Total:   30,
 		Start:   1,
 	}
-	res := sf.formatProgress("id", "action", jsonProgress, nil)
+	res := sf.formatProgress("id", "action", jsonProgress, nil, "")
 	out := string(res)
 	assert.True(t, strings.HasPrefix(out, "action [===="))
 	assert.Contains(t, out, "15B/30B")
@@ -58,12 +58,13 @@ func TestJsonProgressFormatterFormatProgress(t *testing.T) {
 		Total:   30,
 		Start:   1,
 	}
-	res := sf.formatProgress("id", "action", jsonProgress, &AuxFormatter{Writer: &bytes.Buffer{}})
+	res := sf.formatProgress("id", "action", jsonProgress, &AuxFormatter{Writer: &bytes.Buffer{}}, "mirror.example.com")
 	msg := &jsonmessage.JSONMessage{}
 
 	require.NoError(t, json.Unmarshal(res, msg))
 	assert.Equal(t, "id", msg.ID)
 	assert.Equal(t, "action", msg.Status)
+	assert.Equal(t, "mirror.example.com", msg.From)
 
 	// jsonProgress will always be in the format of:
 	// [=========================>                         ]      15B/30B 412910h51m30s
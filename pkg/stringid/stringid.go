@@ -41,6 +41,17 @@ func TruncateID(id string) string {
 	return id
 }
 
+// FormatID formats a string identifier for display. By default the
+// 12-character short form is returned; when full is set the identifier is
+// returned unchanged. Callers that log or print IDs should use this rather
+// than truncating ad hoc, so a single flag can switch between forms.
+func FormatID(id string, full bool) string {
+	if full {
+		return id
+	}
+	return TruncateID(id)
+}
+
 func generateID(r io.Reader) string {
 	b := make([]byte, 32)
 	for {
@@ -70,3 +70,29 @@ func TestIsShortIDNotCorrectSize(t *testing.T) {
 		t.Fatalf("%s is not a short ID", id)
 	}
 }
+
+func TestFormatID(t *testing.T) {
+	id := "90435eec5c4e124e741ef731e118be2fc799a68aba0466ec17717f24ce2ae6a2"
+	short := FormatID(id, false)
+	if short != "90435eec5c4e" {
+		t.Fatalf("Id returned is incorrect: short format of %s returned %s", id, short)
+	}
+	if len(short) != 12 {
+		t.Fatalf("short format should be 12 characters, got %d", len(short))
+	}
+	full := FormatID(id, true)
+	if full != id {
+		t.Fatalf("Id returned is incorrect: full format of %s returned %s", id, full)
+	}
+}
+
+func TestFormatSha256ID(t *testing.T) {
+	id := "sha256:4e38e38c8ce0b8d9041a9c4fefe786631d1416225e13b0bfe8cfa2321aec4bba"
+	short := FormatID(id, false)
+	if short != "4e38e38c8ce0" {
+		t.Fatalf("Id returned is incorrect: short format of %s returned %s", id, short)
+	}
+	if full := FormatID(id, true); full != id {
+		t.Fatalf("Id returned is incorrect: full format of %s returned %s", id, full)
+	}
+}
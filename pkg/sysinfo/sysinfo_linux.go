@@ -26,6 +26,34 @@ func findCgroupMountpoints() (map[string]string, error) {
 	return mps, nil
 }
 
+// requiredCgroupSubsystems are the cgroup subsystems the daemon needs
+// mounted to enforce the corresponding container resource limits.
+var requiredCgroupSubsystems = []string{"cpu", "cpuacct", "cpuset", "memory", "devices", "blkio"}
+
+// CheckCgroupSubsystems returns a single error naming every required cgroup
+// subsystem that is not mounted, so the operator knows exactly what to mount,
+// or nil when all of them are present.
+func CheckCgroupSubsystems() error {
+	cgMounts, err := findCgroupMountpoints()
+	if err != nil {
+		return err
+	}
+	return checkCgroupSubsystems(cgMounts)
+}
+
+func checkCgroupSubsystems(cgMounts map[string]string) error {
+	var missing []string
+	for _, subsystem := range requiredCgroupSubsystems {
+		if _, ok := cgMounts[subsystem]; !ok {
+			missing = append(missing, subsystem)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cgroup subsystems not mounted: %s; the corresponding resource limits will not work until they are mounted", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // New returns a new SysInfo, using the filesystem to detect which features
 // the kernel supports. If `quiet` is `false` warnings are printed in logs
 // whenever an error occurs or misconfigurations are present.
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -102,3 +103,29 @@ func TestNumCPU(t *testing.T) {
 		t.Fatal("CPU returned must be greater than zero")
 	}
 }
+
+func TestCheckCgroupSubsystems(t *testing.T) {
+	mounts := map[string]string{
+		"cpu":     "/sys/fs/cgroup/cpu",
+		"cpuacct": "/sys/fs/cgroup/cpuacct",
+		"cpuset":  "/sys/fs/cgroup/cpuset",
+		"memory":  "/sys/fs/cgroup/memory",
+		"devices": "/sys/fs/cgroup/devices",
+		"blkio":   "/sys/fs/cgroup/blkio",
+	}
+	if err := checkCgroupSubsystems(mounts); err != nil {
+		t.Errorf("expected no error with all subsystems mounted, got %v", err)
+	}
+
+	delete(mounts, "memory")
+	delete(mounts, "blkio")
+	err := checkCgroupSubsystems(mounts)
+	if err == nil {
+		t.Fatal("expected an error with subsystems missing")
+	}
+	for _, want := range []string{"memory", "blkio"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to name %s, got %v", want, err)
+		}
+	}
+}
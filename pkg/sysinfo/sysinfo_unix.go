@@ -7,3 +7,8 @@ func New(quiet bool) *SysInfo {
 	sysInfo := &SysInfo{}
 	return sysInfo
 }
+
+// CheckCgroupSubsystems is a no-op on non linux.
+func CheckCgroupSubsystems() error {
+	return nil
+}
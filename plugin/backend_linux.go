@@ -504,6 +504,10 @@ func (r *pluginReference) AddTag(ref reference.Named, id digest.Digest, force bo
 	// Read only, ignore
 	return nil
 }
+func (r *pluginReference) AddAlias(alias, target reference.NamedTagged) error {
+	// Read only, ignore
+	return nil
+}
 func (r *pluginReference) AddDigest(ref reference.Canonical, id digest.Digest, force bool) error {
 	// Read only, ignore
 	return nil
@@ -513,6 +517,33 @@ func (r *pluginReference) Delete(ref reference.Named) (bool, error) {
 	return false, nil
 }
 
+func (r *pluginReference) DeleteAll(repoName string) ([]string, error) {
+	// Read only, ignore
+	return nil, nil
+}
+
+func (r *pluginReference) ListTags(repoName string) ([]refstore.RepositoryTag, error) {
+	if repoName != reference.FamiliarName(r.name) {
+		return nil, refstore.ErrDoesNotExist
+	}
+	var tags []refstore.RepositoryTag
+	if tagged, ok := r.name.(reference.NamedTagged); ok {
+		tags = append(tags, refstore.RepositoryTag{
+			Tag: tagged.Tag(),
+			ID:  r.pluginID,
+		})
+	}
+	return tags, nil
+}
+
+func (r *pluginReference) Snapshot() map[string]map[string]digest.Digest {
+	return map[string]map[string]digest.Digest{
+		reference.FamiliarName(r.name): {
+			reference.FamiliarString(r.name): r.pluginID,
+		},
+	}
+}
+
 type pluginConfigStore struct {
 	pm     *Manager
 	plugin *v2.Plugin
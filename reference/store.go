@@ -26,23 +26,42 @@ type Association struct {
 	ID  digest.Digest
 }
 
+// A RepositoryTag is one tag of a repository, paired with the image ID it
+// points to.
+type RepositoryTag struct {
+	Tag string
+	ID  digest.Digest
+}
+
 // Store provides the set of methods which can operate on a reference store.
 type Store interface {
 	References(id digest.Digest) []reference.Named
 	ReferencesByName(ref reference.Named) []Association
 	AddTag(ref reference.Named, id digest.Digest, force bool) error
+	AddAlias(alias, target reference.NamedTagged) error
 	AddDigest(ref reference.Canonical, id digest.Digest, force bool) error
 	Delete(ref reference.Named) (bool, error)
+	DeleteAll(repoName string) ([]string, error)
 	Get(ref reference.Named) (digest.Digest, error)
+	ListTags(repoName string) ([]RepositoryTag, error)
+	Snapshot() map[string]map[string]digest.Digest
 }
 
 type store struct {
+	// mu guards Repositories and referencesByIDCache. Callers must never
+	// iterate Repositories directly; use Snapshot, References or
+	// ReferencesByName, which copy under the lock.
 	mu sync.RWMutex
 	// jsonPath is the path to the file where the serialized tag data is
 	// stored.
 	jsonPath string
 	// Repositories is a map of repositories, indexed by name.
 	Repositories map[string]repository
+	// Aliases maps alias references to the target references they resolve
+	// to at lookup time, indexed by repository name. Keeping them apart
+	// from Repositories marks them as aliases in the serialized file,
+	// which stays unchanged for stores that use no aliases.
+	Aliases map[string]map[string]string `json:",omitempty"`
 	// referencesByIDCache is a cache of references indexed by ID, to speed
 	// up References.
 	referencesByIDCache map[digest.Digest]map[string]reference.Named
@@ -68,6 +87,14 @@ func (a lexicalAssociations) Less(i, j int) bool {
 	return a[i].Ref.String() < a[j].Ref.String()
 }
 
+type lexicalTags []RepositoryTag
+
+func (a lexicalTags) Len() int      { return len(a) }
+func (a lexicalTags) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a lexicalTags) Less(i, j int) bool {
+	return a[i].Tag < a[j].Tag
+}
+
 // NewReferenceStore creates a new reference store, tied to a file path where
 // the set of references are serialized in JSON format.
 func NewReferenceStore(jsonPath string) (Store, error) {
@@ -79,6 +106,7 @@ func NewReferenceStore(jsonPath string) (Store, error) {
 	store := &store{
 		jsonPath:            abspath,
 		Repositories:        make(map[string]repository),
+		Aliases:             make(map[string]map[string]string),
 		referencesByIDCache: make(map[digest.Digest]map[string]reference.Named),
 	}
 	// Load the json file if it exists, otherwise create it.
@@ -101,6 +129,75 @@ func (store *store) AddTag(ref reference.Named, id digest.Digest, force bool) er
 	return store.addReference(reference.TagNameOnly(ref), id, force)
 }
 
+// AddAlias adds an alias reference that is resolved to target at lookup
+// time, so the alias follows the target when it is re-tagged. Both
+// references must name a tag in the same repository, the alias must not
+// shadow an existing tag, and chains of aliases must not form a cycle. An
+// alias is removed again when its target is deleted.
+func (store *store) AddAlias(alias, target reference.NamedTagged) error {
+	if reference.FamiliarName(alias) != reference.FamiliarName(target) {
+		return errors.WithStack(invalidTagError("alias and target must name the same repository"))
+	}
+
+	refName := reference.FamiliarName(alias)
+	aliasStr := reference.FamiliarString(alias)
+	targetStr := reference.FamiliarString(target)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if repository := store.Repositories[refName]; repository != nil {
+		if _, exists := repository[aliasStr]; exists {
+			return errors.WithStack(conflictingTagError("Cannot overwrite tag " + aliasStr + " with an alias"))
+		}
+	}
+
+	aliases := store.Aliases[refName]
+	if aliases == nil {
+		aliases = make(map[string]string)
+		store.Aliases[refName] = aliases
+	}
+
+	// Walk the chain starting at target; reaching the alias again would
+	// close a cycle.
+	seen := map[string]struct{}{aliasStr: {}}
+	for next := targetStr; ; {
+		if _, cycle := seen[next]; cycle {
+			return errors.WithStack(invalidTagError("refusing to create an alias cycle"))
+		}
+		seen[next] = struct{}{}
+		var ok bool
+		if next, ok = aliases[next]; !ok {
+			break
+		}
+	}
+
+	aliases[aliasStr] = targetStr
+	return store.save()
+}
+
+// resolveAlias follows refStr through the repository's alias entries to the
+// tag it finally points at. Callers must hold at least the read lock.
+func (store *store) resolveAlias(refName, refStr string) string {
+	aliases := store.Aliases[refName]
+	if aliases == nil {
+		return refStr
+	}
+	seen := make(map[string]struct{})
+	for {
+		target, ok := aliases[refStr]
+		if !ok {
+			return refStr
+		}
+		if _, cycle := seen[target]; cycle {
+			// Should never happen; AddAlias refuses cycles.
+			return refStr
+		}
+		seen[target] = struct{}{}
+		refStr = target
+	}
+}
+
 // AddDigest adds a digest reference to the store.
 func (store *store) AddDigest(ref reference.Canonical, id digest.Digest, force bool) error {
 	return store.addReference(ref, id, force)
@@ -197,6 +294,11 @@ func (store *store) Delete(ref reference.Named) (bool, error) {
 
 	repository, exists := store.Repositories[refName]
 	if !exists {
+		// The reference may still name an alias in a repository that
+		// only has alias entries left.
+		if store.deleteAlias(refName, refStr) {
+			return true, store.save()
+		}
 		return false, ErrDoesNotExist
 	}
 
@@ -211,12 +313,96 @@ func (store *store) Delete(ref reference.Named) (bool, error) {
 				delete(store.referencesByIDCache, id)
 			}
 		}
+		store.deleteDanglingAliases(refName, refStr)
+		return true, store.save()
+	}
+
+	if store.deleteAlias(refName, refStr) {
 		return true, store.save()
 	}
 
 	return false, ErrDoesNotExist
 }
 
+// DeleteAll removes every reference of the named repository, including its
+// aliases, in one locked operation that persists once. It returns the
+// references it removed, sorted, so deleting a repository tag by tag is not
+// needed and concurrent readers never observe a half-emptied repository.
+// ErrDoesNotExist is returned when the repository is not known to the store.
+func (store *store) DeleteAll(repoName string) ([]string, error) {
+	ref, err := reference.ParseNormalizedNamed(repoName)
+	if err != nil {
+		return nil, err
+	}
+	refName := reference.FamiliarName(ref)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	repository, exists := store.Repositories[refName]
+	if !exists {
+		return nil, ErrDoesNotExist
+	}
+
+	removed := make([]string, 0, len(repository))
+	for refStr, id := range repository {
+		removed = append(removed, refStr)
+		if store.referencesByIDCache[id] != nil {
+			delete(store.referencesByIDCache[id], refStr)
+			if len(store.referencesByIDCache[id]) == 0 {
+				delete(store.referencesByIDCache, id)
+			}
+		}
+	}
+	delete(store.Repositories, refName)
+	delete(store.Aliases, refName)
+
+	sort.Strings(removed)
+	return removed, store.save()
+}
+
+// deleteAlias removes refStr's alias entry, if it has one, and reports
+// whether it did. Callers must hold the write lock.
+func (store *store) deleteAlias(refName, refStr string) bool {
+	aliases := store.Aliases[refName]
+	if aliases == nil {
+		return false
+	}
+	if _, exists := aliases[refStr]; !exists {
+		return false
+	}
+	delete(aliases, refStr)
+	store.deleteDanglingAliases(refName, refStr)
+	if len(aliases) == 0 {
+		delete(store.Aliases, refName)
+	}
+	return true
+}
+
+// deleteDanglingAliases removes the aliases left pointing, directly or
+// through other aliases, at the deleted refStr. Callers must hold the write
+// lock.
+func (store *store) deleteDanglingAliases(refName, refStr string) {
+	aliases := store.Aliases[refName]
+	if aliases == nil {
+		return
+	}
+	removed := map[string]struct{}{refStr: {}}
+	for changed := true; changed; {
+		changed = false
+		for aliasStr, targetStr := range aliases {
+			if _, ok := removed[targetStr]; ok {
+				delete(aliases, aliasStr)
+				removed[aliasStr] = struct{}{}
+				changed = true
+			}
+		}
+	}
+	if len(aliases) == 0 {
+		delete(store.Aliases, refName)
+	}
+}
+
 // Get retrieves an item from the store by reference
 func (store *store) Get(ref reference.Named) (digest.Digest, error) {
 	if canonical, ok := ref.(reference.Canonical); ok {
@@ -245,7 +431,7 @@ func (store *store) Get(ref reference.Named) (digest.Digest, error) {
 		return "", ErrDoesNotExist
 	}
 
-	id, exists := repository[refStr]
+	id, exists := repository[store.resolveAlias(refName, refStr)]
 	if !exists {
 		return "", ErrDoesNotExist
 	}
@@ -306,6 +492,66 @@ func (store *store) ReferencesByName(ref reference.Named) []Association {
 	return associations
 }
 
+// ListTags returns the tags of the named repository sorted by tag name,
+// each paired with the image ID it points to. Digest references are not
+// included. ErrDoesNotExist is returned when the repository is not known to
+// the store.
+func (store *store) ListTags(repoName string) ([]RepositoryTag, error) {
+	ref, err := reference.ParseNormalizedNamed(repoName)
+	if err != nil {
+		return nil, err
+	}
+	refName := reference.FamiliarName(ref)
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	repository, exists := store.Repositories[refName]
+	if !exists {
+		return nil, ErrDoesNotExist
+	}
+
+	var tags []RepositoryTag
+	for refStr, refID := range repository {
+		parsed, err := reference.ParseNormalizedNamed(refStr)
+		if err != nil {
+			// Should never happen
+			continue
+		}
+		tagged, isTagged := parsed.(reference.NamedTagged)
+		if !isTagged {
+			continue
+		}
+		tags = append(tags, RepositoryTag{
+			Tag: tagged.Tag(),
+			ID:  refID,
+		})
+	}
+
+	sort.Sort(lexicalTags(tags))
+
+	return tags, nil
+}
+
+// Snapshot returns a deep copy of the repository map, indexed by repository
+// name and then by stringified reference. The copy is safe to iterate without
+// holding the store's lock, and mutating it does not affect the store.
+func (store *store) Snapshot() map[string]map[string]digest.Digest {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	repositories := make(map[string]map[string]digest.Digest, len(store.Repositories))
+	for name, repository := range store.Repositories {
+		references := make(map[string]digest.Digest, len(repository))
+		for refStr, id := range repository {
+			references[refStr] = id
+		}
+		repositories[name] = references
+	}
+
+	return repositories
+}
+
 func (store *store) save() error {
 	// Store the json
 	jsonData, err := json.Marshal(store)
@@ -325,6 +571,11 @@ func (store *store) reload() error {
 		return err
 	}
 
+	// Files written before aliases existed have no Aliases section.
+	if store.Aliases == nil {
+		store.Aliases = make(map[string]map[string]string)
+	}
+
 	for _, repository := range store.Repositories {
 		for refStr, refID := range repository {
 			ref, err := reference.ParseNormalizedNamed(refStr)
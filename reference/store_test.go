@@ -2,10 +2,12 @@ package reference
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/docker/distribution/reference"
@@ -16,11 +18,11 @@ import (
 
 var (
 	saveLoadTestCases = map[string]digest.Digest{
-		"registry:5000/foobar:HEAD":                                                        "sha256:470022b8af682154f57a2163d030eb369549549cba00edc69e1b99b46bb924d6",
-		"registry:5000/foobar:alternate":                                                   "sha256:ae300ebc4a4f00693702cfb0a5e0b7bc527b353828dc86ad09fb95c8a681b793",
-		"registry:5000/foobar:latest":                                                      "sha256:6153498b9ac00968d71b66cca4eac37e990b5f9eb50c26877eb8799c8847451b",
-		"registry:5000/foobar:master":                                                      "sha256:6c9917af4c4e05001b346421959d7ea81b6dc9d25718466a37a6add865dfd7fc",
-		"jess/hollywood:latest":                                                            "sha256:ae7a5519a0a55a2d4ef20ddcbd5d0ca0888a1f7ab806acc8e2a27baf46f529fe",
+		"registry:5000/foobar:HEAD":      "sha256:470022b8af682154f57a2163d030eb369549549cba00edc69e1b99b46bb924d6",
+		"registry:5000/foobar:alternate": "sha256:ae300ebc4a4f00693702cfb0a5e0b7bc527b353828dc86ad09fb95c8a681b793",
+		"registry:5000/foobar:latest":    "sha256:6153498b9ac00968d71b66cca4eac37e990b5f9eb50c26877eb8799c8847451b",
+		"registry:5000/foobar:master":    "sha256:6c9917af4c4e05001b346421959d7ea81b6dc9d25718466a37a6add865dfd7fc",
+		"jess/hollywood:latest":          "sha256:ae7a5519a0a55a2d4ef20ddcbd5d0ca0888a1f7ab806acc8e2a27baf46f529fe",
 		"registry@sha256:367eb40fd0330a7e464777121e39d2f5b3e8e23a1e159342e53ab05c9e4d94e6": "sha256:24126a56805beb9711be5f4590cc2eb55ab8d4a85ebd618eed72bb19fc50631c",
 		"busybox:latest": "sha256:91e54dfb11794fad694460162bf0cb0a4fa710cfa3f60979c177d920813e267c",
 	}
@@ -348,3 +350,227 @@ func TestInvalidTags(t *testing.T) {
 	err = store.AddTag(ref, id, true)
 	assert.Error(t, err)
 }
+
+func TestSnapshot(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tag-store-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	require.NoError(t, err)
+
+	for refStr, id := range saveLoadTestCases {
+		ref, err := reference.ParseNormalizedNamed(refStr)
+		require.NoError(t, err)
+		if canonical, ok := ref.(reference.Canonical); ok {
+			err = store.AddDigest(canonical, id, false)
+		} else {
+			err = store.AddTag(ref, id, false)
+		}
+		require.NoError(t, err)
+	}
+
+	snapshot := store.Snapshot()
+	assert.Len(t, snapshot["busybox"], 1)
+	assert.Equal(t, saveLoadTestCases["busybox:latest"], snapshot["busybox"]["busybox:latest"])
+
+	// Mutating the snapshot must not affect the store.
+	delete(snapshot["busybox"], "busybox:latest")
+	ref, err := reference.ParseNormalizedNamed("busybox:latest")
+	require.NoError(t, err)
+	_, err = store.Get(ref)
+	assert.NoError(t, err)
+}
+
+func TestListTags(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tag-store-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	require.NoError(t, err)
+
+	for refStr, id := range saveLoadTestCases {
+		ref, err := reference.ParseNormalizedNamed(refStr)
+		require.NoError(t, err)
+		if canonical, ok := ref.(reference.Canonical); ok {
+			err = store.AddDigest(canonical, id, false)
+		} else {
+			err = store.AddTag(ref, id, false)
+		}
+		require.NoError(t, err)
+	}
+
+	tags, err := store.ListTags("registry:5000/foobar")
+	require.NoError(t, err)
+	require.Len(t, tags, 4)
+	for i, expected := range []string{"HEAD", "alternate", "latest", "master"} {
+		assert.Equal(t, expected, tags[i].Tag)
+		assert.Equal(t, saveLoadTestCases["registry:5000/foobar:"+expected], tags[i].ID)
+	}
+
+	// Digest references are not listed as tags.
+	tags, err = store.ListTags("registry")
+	require.NoError(t, err)
+	assert.Len(t, tags, 0)
+
+	_, err = store.ListTags("nosuchrepo")
+	assert.Equal(t, ErrDoesNotExist, err)
+}
+
+func TestDeleteAll(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tag-store-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	require.NoError(t, err)
+
+	for refStr, id := range saveLoadTestCases {
+		ref, err := reference.ParseNormalizedNamed(refStr)
+		require.NoError(t, err)
+		if canonical, ok := ref.(reference.Canonical); ok {
+			err = store.AddDigest(canonical, id, false)
+		} else {
+			err = store.AddTag(ref, id, false)
+		}
+		require.NoError(t, err)
+	}
+
+	removed, err := store.DeleteAll("registry:5000/foobar")
+	require.NoError(t, err)
+	expected := []string{
+		"registry:5000/foobar:HEAD",
+		"registry:5000/foobar:alternate",
+		"registry:5000/foobar:latest",
+		"registry:5000/foobar:master",
+	}
+	assert.Equal(t, expected, removed)
+
+	// The repository is gone, and its references no longer resolve.
+	_, err = store.DeleteAll("registry:5000/foobar")
+	assert.Equal(t, ErrDoesNotExist, err)
+	ref, err := reference.ParseNormalizedNamed("registry:5000/foobar:latest")
+	require.NoError(t, err)
+	_, err = store.Get(ref)
+	assert.Equal(t, ErrDoesNotExist, err)
+	id := saveLoadTestCases["registry:5000/foobar:latest"]
+	assert.Len(t, store.References(id), 0)
+
+	// Other repositories are untouched.
+	ref, err = reference.ParseNormalizedNamed("busybox:latest")
+	require.NoError(t, err)
+	_, err = store.Get(ref)
+	assert.NoError(t, err)
+}
+
+func TestAddAlias(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tag-store-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	jsonPath := filepath.Join(tmpDir, "repositories.json")
+	store, err := NewReferenceStore(jsonPath)
+	require.NoError(t, err)
+
+	id := digest.Digest("sha256:470022b8af682154f57a2163d030eb369549549cba00edc69e1b99b46bb924d6")
+	target, err := reference.ParseNormalizedNamed("myapp:1.4.2")
+	require.NoError(t, err)
+	require.NoError(t, store.AddTag(target, id, false))
+
+	alias, err := reference.ParseNormalizedNamed("myapp:stable")
+	require.NoError(t, err)
+	require.NoError(t, store.AddAlias(alias.(reference.NamedTagged), target.(reference.NamedTagged)))
+
+	// The alias resolves to the target's current ID.
+	resolved, err := store.Get(alias)
+	require.NoError(t, err)
+	assert.Equal(t, id, resolved)
+
+	// Re-tagging the target moves the alias with it.
+	newID := digest.Digest("sha256:ae300ebc4a4f00693702cfb0a5e0b7bc527b353828dc86ad09fb95c8a681b793")
+	require.NoError(t, store.AddTag(target, newID, true))
+	resolved, err = store.Get(alias)
+	require.NoError(t, err)
+	assert.Equal(t, newID, resolved)
+
+	// Chained aliases resolve through to the tag; closing a cycle is
+	// refused.
+	alias2, err := reference.ParseNormalizedNamed("myapp:prod")
+	require.NoError(t, err)
+	require.NoError(t, store.AddAlias(alias2.(reference.NamedTagged), alias.(reference.NamedTagged)))
+	resolved, err = store.Get(alias2)
+	require.NoError(t, err)
+	assert.Equal(t, newID, resolved)
+	err = store.AddAlias(target.(reference.NamedTagged), alias2.(reference.NamedTagged))
+	assert.Error(t, err)
+
+	// An alias must not shadow an existing tag, and must stay in the
+	// target's repository.
+	err = store.AddAlias(target.(reference.NamedTagged), alias.(reference.NamedTagged))
+	assert.Error(t, err)
+	otherRepo, err := reference.ParseNormalizedNamed("otherapp:stable")
+	require.NoError(t, err)
+	err = store.AddAlias(otherRepo.(reference.NamedTagged), target.(reference.NamedTagged))
+	assert.Error(t, err)
+
+	// Aliases survive a reload of the store.
+	store, err = NewReferenceStore(jsonPath)
+	require.NoError(t, err)
+	resolved, err = store.Get(alias2)
+	require.NoError(t, err)
+	assert.Equal(t, newID, resolved)
+
+	// Deleting the target deletes the aliases pointing at it, directly or
+	// through another alias.
+	deleted, err := store.Delete(target)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	_, err = store.Get(alias)
+	assert.Equal(t, ErrDoesNotExist, err)
+	_, err = store.Get(alias2)
+	assert.Equal(t, ErrDoesNotExist, err)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tag-store-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	require.NoError(t, err)
+
+	id := digest.Digest("sha256:470022b8af682154f57a2163d030eb369549549cba00edc69e1b99b46bb924d6")
+	name, err := reference.ParseNormalizedNamed("busybox")
+	require.NoError(t, err)
+
+	// Exercise writers against readers; run with -race to catch unguarded
+	// map access.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				ref, err := reference.WithTag(name, fmt.Sprintf("tag-%d-%d", i, j))
+				require.NoError(t, err)
+				require.NoError(t, store.AddTag(ref, id, true))
+			}
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				store.References(id)
+				store.ReferencesByName(name)
+				for _, repository := range store.Snapshot() {
+					for range repository {
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, store.References(id), 40)
+}
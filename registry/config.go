@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,6 +20,15 @@ type ServiceOptions struct {
 	AllowNondistributableArtifacts []string `json:"allow-nondistributable-artifacts,omitempty"`
 	Mirrors                        []string `json:"registry-mirrors,omitempty"`
 	InsecureRegistries             []string `json:"insecure-registries,omitempty"`
+	PushConfirmRegistries          []string `json:"push-confirm-registries,omitempty"`
+	BlockedRegistries              []string `json:"blocked-registries,omitempty"`
+	AllowedRegistries              []string `json:"allowed-registries,omitempty"`
+	ReadOnlyRegistries             []string `json:"read-only-registries,omitempty"`
+
+	// RequireFullyQualifiedNames makes the daemon reject image references
+	// that do not explicitly name the registry they refer to, instead of
+	// qualifying them with the default registry.
+	RequireFullyQualifiedNames bool `json:"require-fully-qualified-names,omitempty"`
 
 	// V2Only controls access to legacy registries.  If it is set to true via the
 	// command line flag the daemon will not attempt to contact v1 legacy registries
@@ -29,6 +39,33 @@ type ServiceOptions struct {
 type serviceConfig struct {
 	registrytypes.ServiceConfig
 	V2Only bool
+	// pushConfirmRegistries is the set of indexes that require an explicit
+	// confirmation before a push is allowed to proceed.
+	pushConfirmRegistries map[string]bool
+	// blockedRegistries is the set of indexes the daemon refuses to
+	// contact for pulls and pushes.
+	blockedRegistries map[string]bool
+	// blockedRegistryPatterns holds the blocked entries that are glob
+	// patterns rather than literal index names.
+	blockedRegistryPatterns []string
+	// blockedRegistryCIDRs holds the blocked entries given in CIDR
+	// notation, matched against the index host's addresses.
+	blockedRegistryCIDRs []*registrytypes.NetIPNet
+	// allowedRegistries, when non-empty, restricts the daemon to only the
+	// listed indexes. Blocked entries take precedence over allowed ones.
+	allowedRegistries map[string]bool
+	// readOnlyRegistries is the set of indexes that may be pulled from
+	// but not pushed to, such as read-only mirrors.
+	readOnlyRegistries map[string]bool
+	// requireFullyQualifiedNames makes the daemon reject image references
+	// that do not explicitly name a registry.
+	requireFullyQualifiedNames bool
+	// indexMirrors maps index names to the mirrors configured for them,
+	// so per-index mirrors survive IndexConfigs being rebuilt.
+	indexMirrors map[string][]string
+	// repoInfoCache caches parsed RepositoryInfo per repository name. It is
+	// cleared whenever index configuration is reloaded.
+	repoInfoCache *repoInfoCache
 }
 
 var (
@@ -79,7 +116,9 @@ func newServiceConfig(options ServiceOptions) (*serviceConfig, error) {
 			// Hack: Bypass setting the mirrors to IndexConfigs since they are going away
 			// and Mirrors are only for the official registry anyways.
 		},
-		V2Only: options.V2Only,
+		V2Only:                     options.V2Only,
+		requireFullyQualifiedNames: options.RequireFullyQualifiedNames,
+		repoInfoCache:              newRepoInfoCache(),
 	}
 	if err := config.LoadAllowNondistributableArtifacts(options.AllowNondistributableArtifacts); err != nil {
 		return nil, err
@@ -90,22 +129,187 @@ func newServiceConfig(options ServiceOptions) (*serviceConfig, error) {
 	if err := config.LoadInsecureRegistries(options.InsecureRegistries); err != nil {
 		return nil, err
 	}
+	if err := config.LoadPushConfirmRegistries(options.PushConfirmRegistries); err != nil {
+		return nil, err
+	}
+	if err := config.LoadBlockedRegistries(options.BlockedRegistries); err != nil {
+		return nil, err
+	}
+	if err := config.LoadAllowedRegistries(options.AllowedRegistries); err != nil {
+		return nil, err
+	}
+	if err := config.LoadReadOnlyRegistries(options.ReadOnlyRegistries); err != nil {
+		return nil, err
+	}
 
 	return config, nil
 }
 
+// LoadReadOnlyRegistries loads the set of registries that may be pulled from
+// but not pushed to into config.
+func (config *serviceConfig) LoadReadOnlyRegistries(registries []string) error {
+	readOnly := make(map[string]bool)
+
+	for _, r := range registries {
+		if validateNoScheme(r) != nil {
+			return fmt.Errorf("read-only registry %s should not contain '://'", r)
+		}
+		name, err := ValidateIndexName(r)
+		if err != nil {
+			return err
+		}
+		if err := validateHostPort(name); err != nil {
+			return fmt.Errorf("read-only registry %s is not valid: %v", r, err)
+		}
+		readOnly[name] = true
+	}
+
+	config.readOnlyRegistries = readOnly
+	return nil
+}
+
+// isIndexReadOnly returns true if the given index may be pulled from but not
+// pushed to.
+func (config *serviceConfig) isIndexReadOnly(indexName string) bool {
+	indexName, err := ValidateIndexName(indexName)
+	if err != nil {
+		return false
+	}
+	return config.readOnlyRegistries[indexName]
+}
+
+// LoadAllowedRegistries loads the allowlist of registries into config. When
+// the allowlist is non-empty, indexes not on it are treated as blocked.
+func (config *serviceConfig) LoadAllowedRegistries(registries []string) error {
+	allowed := make(map[string]bool)
+
+	for _, r := range registries {
+		if validateNoScheme(r) != nil {
+			return fmt.Errorf("allowed registry %s should not contain '://'", r)
+		}
+		name, err := ValidateIndexName(r)
+		if err != nil {
+			return err
+		}
+		if err := validateHostPort(name); err != nil {
+			return fmt.Errorf("allowed registry %s is not valid: %v", r, err)
+		}
+		allowed[name] = true
+	}
+
+	config.allowedRegistries = allowed
+	return nil
+}
+
+// LoadBlockedRegistries loads the set of registries the daemon refuses to
+// contact into config. Entries may be shell-style glob patterns such as
+// "*.corp.example.com" or subnets in CIDR notation; the literal "*" blocks
+// every index.
+func (config *serviceConfig) LoadBlockedRegistries(registries []string) error {
+	blocked := make(map[string]bool)
+	patterns := []string{}
+	cidrs := []*registrytypes.NetIPNet{}
+
+	for _, r := range registries {
+		if validateNoScheme(r) != nil {
+			return fmt.Errorf("blocked registry %s should not contain '://'", r)
+		}
+		name, err := ValidateIndexName(r)
+		if err != nil {
+			return err
+		}
+		if _, ipnet, err := net.ParseCIDR(name); err == nil {
+			cidrs = append(cidrs, (*registrytypes.NetIPNet)(ipnet))
+			continue
+		}
+		if strings.ContainsAny(name, "*?[") {
+			if _, err := path.Match(name, ""); err != nil {
+				return fmt.Errorf("blocked registry pattern %s is not valid: %v", r, err)
+			}
+			patterns = append(patterns, name)
+			continue
+		}
+		if err := validateHostPort(name); err != nil {
+			return fmt.Errorf("blocked registry %s is not valid: %v", r, err)
+		}
+		blocked[name] = true
+	}
+
+	config.blockedRegistries = blocked
+	config.blockedRegistryPatterns = patterns
+	config.blockedRegistryCIDRs = cidrs
+	return nil
+}
+
+// isIndexBlocked returns true if the daemon is configured to refuse contact
+// with the given index, either because the index is explicitly blocked, or
+// matches a blocked glob pattern, or because a non-empty allowlist does not
+// include it. An explicit block takes precedence over an allowlist entry.
+func (config *serviceConfig) isIndexBlocked(indexName string) bool {
+	indexName, err := ValidateIndexName(indexName)
+	if err != nil {
+		return false
+	}
+	if config.blockedRegistries[indexName] {
+		return true
+	}
+	for _, pattern := range config.blockedRegistryPatterns {
+		// Patterns are validated at load time, so the error can't fire.
+		if matched, _ := path.Match(pattern, indexName); matched {
+			return true
+		}
+	}
+	if isCIDRMatch(config.blockedRegistryCIDRs, indexName) {
+		return true
+	}
+	return len(config.allowedRegistries) > 0 && !config.allowedRegistries[indexName]
+}
+
+// LoadPushConfirmRegistries loads the set of registries that require push
+// confirmation into config.
+func (config *serviceConfig) LoadPushConfirmRegistries(registries []string) error {
+	confirm := make(map[string]bool)
+
+	for _, r := range registries {
+		if validateNoScheme(r) != nil {
+			return fmt.Errorf("push-confirm registry %s should not contain '://'", r)
+		}
+		name, err := ValidateIndexName(r)
+		if err != nil {
+			return err
+		}
+		if err := validateHostPort(name); err != nil {
+			return fmt.Errorf("push-confirm registry %s is not valid: %v", r, err)
+		}
+		confirm[name] = true
+	}
+
+	config.pushConfirmRegistries = confirm
+	return nil
+}
+
+// requiresPushConfirmation returns true if pushes to the given index must be
+// explicitly confirmed by the client.
+func (config *serviceConfig) requiresPushConfirmation(indexName string) bool {
+	indexName, err := ValidateIndexName(indexName)
+	if err != nil {
+		return false
+	}
+	return config.pushConfirmRegistries[indexName]
+}
+
 // LoadAllowNondistributableArtifacts loads allow-nondistributable-artifacts registries into config.
 func (config *serviceConfig) LoadAllowNondistributableArtifacts(registries []string) error {
 	cidrs := map[string]*registrytypes.NetIPNet{}
 	hostnames := map[string]bool{}
 
 	for _, r := range registries {
-		if _, err := ValidateIndexName(r); err != nil {
-			return err
-		}
 		if validateNoScheme(r) != nil {
 			return fmt.Errorf("allow-nondistributable-artifacts registry %s should not contain '://'", r)
 		}
+		if _, err := ValidateIndexName(r); err != nil {
+			return err
+		}
 
 		if _, ipnet, err := net.ParseCIDR(r); err == nil {
 			// Valid CIDR.
@@ -131,24 +335,37 @@ func (config *serviceConfig) LoadAllowNondistributableArtifacts(registries []str
 	return nil
 }
 
-// LoadMirrors loads mirrors to config, after removing duplicates.
-// Returns an error if mirrors contains an invalid mirror.
+// LoadMirrors loads mirrors to config, after removing duplicates. A mirror
+// may carry a "=<index>" suffix to attach it to that index; bare mirrors
+// belong to the official index. Returns an error if mirrors contains an
+// invalid mirror.
 func (config *serviceConfig) LoadMirrors(mirrors []string) error {
 	mMap := map[string]struct{}{}
-	unique := []string{}
+	indexMirrors := map[string][]string{}
 
 	for _, mirror := range mirrors {
 		m, err := ValidateMirror(mirror)
 		if err != nil {
 			return err
 		}
-		if _, exist := mMap[m]; !exist {
-			mMap[m] = struct{}{}
-			unique = append(unique, m)
+		if _, exist := mMap[m]; exist {
+			continue
 		}
+		mMap[m] = struct{}{}
+
+		indexName := IndexName
+		if i := strings.IndexRune(m, '='); i != -1 {
+			m, indexName = m[:i], m[i+1:]
+		}
+		indexMirrors[indexName] = append(indexMirrors[indexName], m)
 	}
 
-	config.Mirrors = unique
+	config.indexMirrors = indexMirrors
+	config.Mirrors = indexMirrors[IndexName]
+	if config.Mirrors == nil {
+		config.Mirrors = []string{}
+	}
+	config.repoInfoCache.clear()
 
 	// Configure public registry since mirrors may have changed.
 	config.IndexConfigs[IndexName] = &registrytypes.IndexInfo{
@@ -157,10 +374,37 @@ func (config *serviceConfig) LoadMirrors(mirrors []string) error {
 		Secure:   true,
 		Official: true,
 	}
+	config.applyIndexMirrors()
 
 	return nil
 }
 
+// applyIndexMirrors populates IndexInfo.Mirrors for every index that has
+// mirrors configured, creating index entries where needed. It must be called
+// again whenever IndexConfigs is rebuilt.
+func (config *serviceConfig) applyIndexMirrors() {
+	for indexName, mirrors := range config.indexMirrors {
+		if index, ok := config.IndexConfigs[indexName]; ok {
+			index.Mirrors = mirrors
+			continue
+		}
+		config.IndexConfigs[indexName] = &registrytypes.IndexInfo{
+			Name:     indexName,
+			Mirrors:  mirrors,
+			Secure:   isSecureIndex(config, indexName),
+			Official: false,
+		}
+	}
+}
+
+// mirrorsForIndex returns the mirrors configured for the given index name.
+func (config *serviceConfig) mirrorsForIndex(indexName string) []string {
+	if index, ok := config.IndexConfigs[indexName]; ok {
+		return index.Mirrors
+	}
+	return nil
+}
+
 // LoadInsecureRegistries loads insecure registries to config
 func (config *serviceConfig) LoadInsecureRegistries(registries []string) error {
 	// Localhost is by default considered as an insecure registry
@@ -170,6 +414,8 @@ func (config *serviceConfig) LoadInsecureRegistries(registries []string) error {
 	// daemon flags on boot2docker?
 	registries = append(registries, "127.0.0.0/8")
 
+	config.repoInfoCache.clear()
+
 	// Store original InsecureRegistryCIDRs and IndexConfigs
 	// Clean InsecureRegistryCIDRs and IndexConfigs in config, as passed registries has all insecure registry info.
 	originalCIDRs := config.ServiceConfig.InsecureRegistryCIDRs
@@ -180,13 +426,6 @@ func (config *serviceConfig) LoadInsecureRegistries(registries []string) error {
 
 skip:
 	for _, r := range registries {
-		// validate insecure registry
-		if _, err := ValidateIndexName(r); err != nil {
-			// before returning err, roll back to original data
-			config.ServiceConfig.InsecureRegistryCIDRs = originalCIDRs
-			config.ServiceConfig.IndexConfigs = originalIndexInfos
-			return err
-		}
 		if strings.HasPrefix(strings.ToLower(r), "http://") {
 			logrus.Warnf("insecure registry %s should not contain 'http://' and 'http://' has been removed from the insecure registry config", r)
 			r = r[7:]
@@ -200,6 +439,14 @@ skip:
 			config.ServiceConfig.IndexConfigs = originalIndexInfos
 			return fmt.Errorf("insecure registry %s should not contain '://'", r)
 		}
+		// validate insecure registry, after any scheme prefix has been
+		// stripped off
+		if _, err := ValidateIndexName(r); err != nil {
+			// before returning err, roll back to original data
+			config.ServiceConfig.InsecureRegistryCIDRs = originalCIDRs
+			config.ServiceConfig.IndexConfigs = originalIndexInfos
+			return err
+		}
 		// Check if CIDR was passed to --insecure-registry
 		_, ipnet, err := net.ParseCIDR(r)
 		if err == nil {
@@ -237,6 +484,7 @@ skip:
 		Secure:   true,
 		Official: true,
 	}
+	config.applyIndexMirrors()
 
 	return nil
 }
@@ -272,13 +520,39 @@ func allowNondistributableArtifacts(config *serviceConfig, hostname string) bool
 // in a subnet. If the resolving is not successful, isSecureIndex will only try to match hostname to any element
 // of insecureRegistries.
 func isSecureIndex(config *serviceConfig, indexName string) bool {
+	secure, _ := resolveSecureIndex(config, indexName)
+	return secure
+}
+
+// SecureIndexReason says how the secure/insecure decision for an index was
+// reached, so it can be explained to the user.
+type SecureIndexReason string
+
+const (
+	// SecureIndexReasonConfigured means a configured IndexInfo decided;
+	// per-index configuration wins over CIDR matching.
+	SecureIndexReasonConfigured SecureIndexReason = "configured"
+	// SecureIndexReasonCIDR means the index matched an insecure-registry
+	// CIDR.
+	SecureIndexReasonCIDR SecureIndexReason = "cidr"
+	// SecureIndexReasonDefault means nothing matched and the index got the
+	// secure default.
+	SecureIndexReasonDefault SecureIndexReason = "default"
+)
+
+// resolveSecureIndex is isSecureIndex with the resolution reason alongside
+// the boolean.
+func resolveSecureIndex(config *serviceConfig, indexName string) (bool, SecureIndexReason) {
 	// Check for configured index, first.  This is needed in case isSecureIndex
 	// is called from anything besides newIndexInfo, in order to honor per-index configurations.
 	if index, ok := config.IndexConfigs[indexName]; ok {
-		return index.Secure
+		return index.Secure, SecureIndexReasonConfigured
 	}
 
-	return !isCIDRMatch(config.InsecureRegistryCIDRs, indexName)
+	if isCIDRMatch(config.InsecureRegistryCIDRs, indexName) {
+		return false, SecureIndexReasonCIDR
+	}
+	return true, SecureIndexReasonDefault
 }
 
 // isCIDRMatch returns true if URLHost matches an element of cidrs. URLHost is a URL.Host (`host:port` or `host`)
@@ -316,11 +590,17 @@ func isCIDRMatch(cidrs []*registrytypes.NetIPNet, URLHost string) bool {
 	return false
 }
 
-// ValidateMirror validates an HTTP(S) registry mirror
+// ValidateMirror validates an HTTP(S) registry mirror. The mirror may carry
+// a "=<index>" suffix to attach it to that index instead of the official one,
+// in which case the normalized form keeps the suffix.
 func ValidateMirror(val string) (string, error) {
-	uri, err := url.Parse(val)
+	mirror, indexName := val, ""
+	if i := strings.IndexRune(val, '='); i != -1 {
+		mirror, indexName = val[:i], val[i+1:]
+	}
+	uri, err := url.Parse(mirror)
 	if err != nil {
-		return "", fmt.Errorf("invalid mirror: %q is not a valid URI", val)
+		return "", fmt.Errorf("invalid mirror: %q is not a valid URI", mirror)
 	}
 	if uri.Scheme != "http" && uri.Scheme != "https" {
 		return "", fmt.Errorf("invalid mirror: unsupported scheme %q in %q", uri.Scheme, uri)
@@ -333,21 +613,66 @@ func ValidateMirror(val string) (string, error) {
 		uri.User = url.UserPassword(uri.User.Username(), "xxxxx")
 		return "", fmt.Errorf("invalid mirror: username/password not allowed in URI %q", uri)
 	}
-	return strings.TrimSuffix(val, "/") + "/", nil
+	normalized := strings.TrimSuffix(mirror, "/") + "/"
+	if indexName == "" {
+		return normalized, nil
+	}
+	name, err := ValidateIndexName(indexName)
+	if err != nil {
+		return "", err
+	}
+	if err := validateHostPort(name); err != nil {
+		return "", fmt.Errorf("invalid mirror: index %q is not valid: %v", indexName, err)
+	}
+	return normalized + "=" + name, nil
 }
 
 // ValidateIndexName validates an index name.
 func ValidateIndexName(val string) (string, error) {
 	// TODO: upstream this to check to reference package
+	if validateNoScheme(val) != nil {
+		return "", fmt.Errorf("invalid index name (%s). Index names must not contain a scheme", val)
+	}
 	if val == "index.docker.io" {
 		val = "docker.io"
 	}
 	if strings.HasPrefix(val, "-") || strings.HasSuffix(val, "-") {
 		return "", fmt.Errorf("invalid index name (%s). Cannot begin or end with a hyphen", val)
 	}
+	// Entries in CIDR notation legitimately contain a slash; any other
+	// slash introduces a path component, which an index name cannot have.
+	if strings.Contains(val, "/") {
+		if _, _, err := net.ParseCIDR(val); err != nil {
+			return "", fmt.Errorf("invalid index name (%s). Index names must not contain a path", val)
+		}
+	}
 	return val, nil
 }
 
+// ShortenForDisplay returns the shortest name that would parse back to ref,
+// for use when rendering image names in list output. Official images on the
+// default registry lose the "docker.io/library/" prefix, other default-
+// registry images lose "docker.io/", and names on any other registry are
+// returned unchanged. It is the inverse of the qualification performed when
+// parsing a name.
+func ShortenForDisplay(ref reference.Named) string {
+	return reference.FamiliarString(ref)
+}
+
+// IsNameFullyQualified returns true if the given image name explicitly names
+// the registry it refers to. The check mirrors the heuristic the reference
+// package uses when normalizing names: the part before the first slash is a
+// registry if it contains a dot or a port, or is "localhost"; everything else
+// would be silently qualified with the default registry.
+func IsNameFullyQualified(name string) bool {
+	i := strings.IndexRune(name, '/')
+	if i == -1 {
+		return false
+	}
+	domain := name[:i]
+	return strings.ContainsAny(domain, ".:") || domain == "localhost"
+}
+
 func validateNoScheme(reposName string) error {
 	if strings.Contains(reposName, "://") {
 		// It cannot contain a scheme!
@@ -404,27 +729,43 @@ func newIndexInfo(config *serviceConfig, indexName string) (*registrytypes.Index
 }
 
 // GetAuthConfigKey special-cases using the full index address of the official
-// index as the AuthConfig key, and uses the (host)name[:port] for private indexes.
+// index as the AuthConfig key, and uses the (host)name[:port] for private
+// indexes. The name is normalized through ValidateIndexName so credentials
+// stored under an index alias (such as index.docker.io) resolve for the
+// canonical spelling too.
 func GetAuthConfigKey(index *registrytypes.IndexInfo) string {
 	if index.Official {
 		return IndexServer
 	}
+	if name, err := ValidateIndexName(index.Name); err == nil {
+		return name
+	}
 	return index.Name
 }
 
 // newRepositoryInfo validates and breaks down a repository name into a RepositoryInfo
 func newRepositoryInfo(config *serviceConfig, name reference.Named) (*RepositoryInfo, error) {
+	key := name.String()
+	if info, ok := config.repoInfoCache.get(key); ok {
+		return info, nil
+	}
+
 	index, err := newIndexInfo(config, reference.Domain(name))
 	if err != nil {
 		return nil, err
 	}
 	official := !strings.ContainsRune(reference.FamiliarName(name), '/')
 
-	return &RepositoryInfo{
+	info := &RepositoryInfo{
 		Name:     reference.TrimNamed(name),
 		Index:    index,
 		Official: official,
-	}, nil
+	}
+	config.repoInfoCache.add(key, info)
+
+	// Hand the caller its own copy so mutations don't reach the cache.
+	result := *info
+	return &result, nil
 }
 
 // ParseRepositoryInfo performs the breakdown of a repository name into a RepositoryInfo, but
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/docker/distribution/reference"
+	registrytypes "github.com/docker/docker/api/types/registry"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -130,6 +132,8 @@ func TestValidateMirror(t *testing.T) {
 	valid := []string{
 		"http://mirror-1.com",
 		"http://mirror-1.com/",
+		"http://mirror-1.com=registry.example.com",
+		"https://mirror-1.com/=registry.example.com:5000",
 		"https://mirror-1.com",
 		"https://mirror-1.com/",
 		"http://localhost",
@@ -156,6 +160,8 @@ func TestValidateMirror(t *testing.T) {
 		"https://mirror-1.com/v1/",
 		"https://mirror-1.com/v1/#",
 		"https://mirror-1.com?q",
+		"http://mirror-1.com=registry.example.com/path",
+		"https://mirror-1.com=-registry.example.com",
 	}
 
 	for _, address := range valid {
@@ -171,6 +177,59 @@ func TestValidateMirror(t *testing.T) {
 	}
 }
 
+func TestLoadMirrorsPerIndex(t *testing.T) {
+	config, err := newServiceConfig(ServiceOptions{
+		Mirrors: []string{
+			"https://mirror-1.com",
+			"https://mirror.example.com=registry.example.com",
+			"https://mirror.example.com=registry.example.com", // duplicate
+			"https://mirror-2.example.com/=registry.example.com",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	official := config.IndexConfigs[IndexName]
+	if official == nil || len(official.Mirrors) != 1 || official.Mirrors[0] != "https://mirror-1.com/" {
+		t.Errorf("unexpected official index mirrors: %v", official)
+	}
+
+	index := config.IndexConfigs["registry.example.com"]
+	if index == nil {
+		t.Fatal("expected an index entry for registry.example.com")
+	}
+	expected := []string{"https://mirror.example.com/", "https://mirror-2.example.com/"}
+	if len(index.Mirrors) != len(expected) {
+		t.Fatalf("expected mirrors %v, got %v", expected, index.Mirrors)
+	}
+	for i, m := range expected {
+		if index.Mirrors[i] != m {
+			t.Errorf("expected mirror %d to be %s, got %s", i, m, index.Mirrors[i])
+		}
+	}
+
+	// Reloading insecure registries rebuilds IndexConfigs; per-index
+	// mirrors must survive.
+	if err := config.LoadInsecureRegistries([]string{"registry.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	index = config.IndexConfigs["registry.example.com"]
+	if index == nil || len(index.Mirrors) != len(expected) {
+		t.Fatalf("expected mirrors to survive reload, got %v", index)
+	}
+	if index.Secure {
+		t.Error("expected registry.example.com to be insecure after reload")
+	}
+
+	if mirrors := config.mirrorsForIndex("registry.example.com"); len(mirrors) != len(expected) {
+		t.Errorf("mirrorsForIndex returned %v", mirrors)
+	}
+	if mirrors := config.mirrorsForIndex("other.example.com"); len(mirrors) != 0 {
+		t.Errorf("expected no mirrors for unconfigured index, got %v", mirrors)
+	}
+}
+
 func TestLoadInsecureRegistries(t *testing.T) {
 	testCases := []struct {
 		registries []string
@@ -286,7 +345,7 @@ func TestNewServiceConfig(t *testing.T) {
 			ServiceOptions{
 				InsecureRegistries: []string{"[fe80::]/64"},
 			},
-			`insecure registry [fe80::]/64 is not valid: invalid host "[fe80::]/64"`,
+			"invalid index name ([fe80::]/64). Index names must not contain a path",
 		},
 		{
 			ServiceOptions{
@@ -298,7 +357,7 @@ func TestNewServiceConfig(t *testing.T) {
 			ServiceOptions{
 				AllowNondistributableArtifacts: []string{"[fe80::]/64"},
 			},
-			`allow-nondistributable-artifacts registry [fe80::]/64 is not valid: invalid host "[fe80::]/64"`,
+			"invalid index name ([fe80::]/64). Index names must not contain a path",
 		},
 		{
 			ServiceOptions{
@@ -340,8 +399,8 @@ func TestValidateIndexName(t *testing.T) {
 			expect: "mytest-1.com",
 		},
 		{
-			index:  "mirror-1.com/v1/?q=foo",
-			expect: "mirror-1.com/v1/?q=foo",
+			index:  "102.10.8.1/24",
+			expect: "102.10.8.1/24",
 		},
 	}
 
@@ -372,9 +431,377 @@ func TestValidateIndexNameWithError(t *testing.T) {
 			index: "mirror-1.com/v1/?q=foo-",
 			err:   "invalid index name (mirror-1.com/v1/?q=foo-). Cannot begin or end with a hyphen",
 		},
+		{
+			index: "https://example.com",
+			err:   "invalid index name (https://example.com). Index names must not contain a scheme",
+		},
+		{
+			index: "mirror-1.com/v1/?q=foo",
+			err:   "invalid index name (mirror-1.com/v1/?q=foo). Index names must not contain a path",
+		},
+		{
+			index: "example.com/path",
+			err:   "invalid index name (example.com/path). Index names must not contain a path",
+		},
 	}
 	for _, testCase := range invalid {
 		_, err := ValidateIndexName(testCase.index)
 		assert.EqualError(t, err, testCase.err)
 	}
 }
+
+func TestGetAuthConfigKey(t *testing.T) {
+	testCases := []struct {
+		index    *registrytypes.IndexInfo
+		expected string
+	}{
+		{
+			index:    &registrytypes.IndexInfo{Name: "docker.io", Official: true},
+			expected: IndexServer,
+		},
+		{
+			index:    &registrytypes.IndexInfo{Name: "registry.example.com"},
+			expected: "registry.example.com",
+		},
+		{
+			// Aliases normalize to their canonical spelling so stored
+			// credentials resolve for either form.
+			index:    &registrytypes.IndexInfo{Name: "index.docker.io"},
+			expected: "docker.io",
+		},
+		{
+			// Names that fail validation pass through unchanged.
+			index:    &registrytypes.IndexInfo{Name: "-bad.example.com"},
+			expected: "-bad.example.com",
+		},
+	}
+	for _, testCase := range testCases {
+		if key := GetAuthConfigKey(testCase.index); key != testCase.expected {
+			t.Errorf("GetAuthConfigKey(%q) = %q, expected %q", testCase.index.Name, key, testCase.expected)
+		}
+	}
+}
+
+func TestLoadPushConfirmRegistries(t *testing.T) {
+	testCases := []struct {
+		registries []string
+		index      string
+		err        string
+	}{
+		{
+			registries: []string{"myregistry.example.com"},
+			index:      "myregistry.example.com",
+		},
+		{
+			registries: []string{"127.0.0.1:5000"},
+			index:      "127.0.0.1:5000",
+		},
+		{
+			registries: []string{"index.docker.io"},
+			index:      "docker.io",
+		},
+		{
+			registries: []string{"https://myregistry.example.com"},
+			err:        "push-confirm registry https://myregistry.example.com should not contain '://'",
+		},
+		{
+			registries: []string{"-invalid-registry"},
+			err:        "Cannot begin or end with a hyphen",
+		},
+		{
+			registries: []string{"mytest-.com"},
+			err:        `push-confirm registry mytest-.com is not valid: invalid host "mytest-.com"`,
+		},
+	}
+	for _, testCase := range testCases {
+		config, err := newServiceConfig(ServiceOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = config.LoadPushConfirmRegistries(testCase.registries)
+		if testCase.err == "" {
+			if err != nil {
+				t.Fatalf("expect no error, got '%s'", err)
+			}
+			if !config.requiresPushConfirmation(testCase.index) {
+				t.Fatalf("expect index configured for push confirmation, got %v", config.pushConfirmRegistries)
+			}
+			if config.requiresPushConfirmation("other.example.com") {
+				t.Fatal("expect unlisted index not to require push confirmation")
+			}
+		} else {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Fatalf("expect error '%s', got '%v'", testCase.err, err)
+			}
+		}
+	}
+}
+
+func TestLoadBlockedRegistries(t *testing.T) {
+	testCases := []struct {
+		registries []string
+		index      string
+		err        string
+	}{
+		{
+			registries: []string{"blocked.example.com"},
+			index:      "blocked.example.com",
+		},
+		{
+			registries: []string{"127.0.0.1:5000"},
+			index:      "127.0.0.1:5000",
+		},
+		{
+			registries: []string{"index.docker.io"},
+			index:      "docker.io",
+		},
+		{
+			registries: []string{"http://blocked.example.com"},
+			err:        "blocked registry http://blocked.example.com should not contain '://'",
+		},
+		{
+			registries: []string{"-invalid-registry"},
+			err:        "Cannot begin or end with a hyphen",
+		},
+		{
+			registries: []string{"mytest-.com"},
+			err:        `blocked registry mytest-.com is not valid: invalid host "mytest-.com"`,
+		},
+		{
+			registries: []string{"*.corp.example.com"},
+			index:      "foo.corp.example.com",
+		},
+		{
+			registries: []string{"10.0.0.0/8"},
+			index:      "10.1.2.3:5000",
+		},
+		{
+			registries: []string{"[invalid.example.com"},
+			err:        "blocked registry pattern [invalid.example.com is not valid",
+		},
+	}
+	for _, testCase := range testCases {
+		config, err := newServiceConfig(ServiceOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = config.LoadBlockedRegistries(testCase.registries)
+		if testCase.err == "" {
+			if err != nil {
+				t.Fatalf("expect no error, got '%s'", err)
+			}
+			if !config.isIndexBlocked(testCase.index) {
+				t.Fatalf("expect index blocked, got %v", config.blockedRegistries)
+			}
+			if config.isIndexBlocked("other.example.com") {
+				t.Fatal("expect unlisted index not to be blocked")
+			}
+		} else {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Fatalf("expect error '%s', got '%v'", testCase.err, err)
+			}
+		}
+	}
+}
+
+func TestBlockedRegistryPatterns(t *testing.T) {
+	config, err := newServiceConfig(ServiceOptions{
+		BlockedRegistries: []string{"*.corp.example.com", "explicit.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := []string{
+		"foo.corp.example.com",
+		"a.b.corp.example.com",
+		"explicit.example.com",
+	}
+	for _, index := range blocked {
+		if !config.isIndexBlocked(index) {
+			t.Errorf("expected %s to be blocked", index)
+		}
+	}
+
+	notBlocked := []string{
+		"corp.example.com", // the pattern requires a leading label
+		"other.example.com",
+		"docker.io",
+	}
+	for _, index := range notBlocked {
+		if config.isIndexBlocked(index) {
+			t.Errorf("expected %s not to be blocked", index)
+		}
+	}
+
+	// The literal "*" blocks every index, including allowlisted ones.
+	config, err = newServiceConfig(ServiceOptions{
+		BlockedRegistries: []string{"*"},
+		AllowedRegistries: []string{"registry.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []string{"registry.example.com", "docker.io"} {
+		if !config.isIndexBlocked(index) {
+			t.Errorf("expected %s to be blocked by *", index)
+		}
+	}
+}
+
+func TestAllowedAndBlockedRegistries(t *testing.T) {
+	testCases := []struct {
+		allowed       []string
+		blocked       []string
+		index         string
+		blockedResult bool
+	}{
+		// No allowlist: only explicitly blocked indexes are refused.
+		{
+			index: "anything.example.com",
+		},
+		{
+			blocked:       []string{"blocked.example.com"},
+			index:         "blocked.example.com",
+			blockedResult: true,
+		},
+		// Non-empty allowlist: unlisted indexes are refused.
+		{
+			allowed: []string{"allowed.example.com"},
+			index:   "allowed.example.com",
+		},
+		{
+			allowed:       []string{"allowed.example.com"},
+			index:         "other.example.com",
+			blockedResult: true,
+		},
+		{
+			allowed: []string{"docker.io"},
+			index:   "docker.io",
+		},
+		{
+			allowed:       []string{"allowed.example.com"},
+			index:         "docker.io",
+			blockedResult: true,
+		},
+		// An explicit block takes precedence over an allowlist entry.
+		{
+			allowed:       []string{"both.example.com"},
+			blocked:       []string{"both.example.com"},
+			index:         "both.example.com",
+			blockedResult: true,
+		},
+	}
+	for _, testCase := range testCases {
+		config, err := newServiceConfig(ServiceOptions{
+			AllowedRegistries: testCase.allowed,
+			BlockedRegistries: testCase.blocked,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked := config.isIndexBlocked(testCase.index); blocked != testCase.blockedResult {
+			t.Fatalf("allowed=%v blocked=%v: expected isIndexBlocked(%q) to be %v, got %v",
+				testCase.allowed, testCase.blocked, testCase.index, testCase.blockedResult, blocked)
+		}
+	}
+}
+
+func TestLoadReadOnlyRegistries(t *testing.T) {
+	testCases := []struct {
+		registries []string
+		index      string
+		err        string
+	}{
+		{
+			registries: []string{"mirror.example.com"},
+			index:      "mirror.example.com",
+		},
+		{
+			registries: []string{"index.docker.io"},
+			index:      "docker.io",
+		},
+		{
+			registries: []string{"http://mirror.example.com"},
+			err:        "read-only registry http://mirror.example.com should not contain '://'",
+		},
+		{
+			registries: []string{"mytest-.com"},
+			err:        `read-only registry mytest-.com is not valid: invalid host "mytest-.com"`,
+		},
+	}
+	for _, testCase := range testCases {
+		config, err := newServiceConfig(ServiceOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = config.LoadReadOnlyRegistries(testCase.registries)
+		if testCase.err == "" {
+			if err != nil {
+				t.Fatalf("expect no error, got '%s'", err)
+			}
+			if !config.isIndexReadOnly(testCase.index) {
+				t.Fatalf("expect index read-only, got %v", config.readOnlyRegistries)
+			}
+			// A read-only registry remains usable for pulls.
+			if config.isIndexBlocked(testCase.index) {
+				t.Fatal("expect read-only index not to be blocked for pulls")
+			}
+		} else {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Fatalf("expect error '%s', got '%v'", testCase.err, err)
+			}
+		}
+	}
+}
+
+func TestIsNameFullyQualified(t *testing.T) {
+	qualified := []string{
+		"docker.io/library/busybox",
+		"index.docker.io/busybox:latest",
+		"localhost/foo",
+		"localhost:5000/foo/bar",
+		"registry.example.com/project/image:tag",
+		"registry.example.com:5000/project/image@sha256:e9e3917527bc41bbf29744e1ab3c1a28b77f12e1a8c9a4b4ecf6dcb1ddc19be5",
+		"127.0.0.1:5000/foo",
+	}
+	for _, name := range qualified {
+		if !IsNameFullyQualified(name) {
+			t.Errorf("expected %q to be fully qualified", name)
+		}
+	}
+
+	unqualified := []string{
+		"busybox",
+		"busybox:latest",
+		"library/busybox",
+		"foo/bar/baz",
+		"foo/bar:tag",
+	}
+	for _, name := range unqualified {
+		if IsNameFullyQualified(name) {
+			t.Errorf("expected %q not to be fully qualified", name)
+		}
+	}
+}
+
+func TestShortenForDisplay(t *testing.T) {
+	testCases := map[string]string{
+		"docker.io/library/busybox":         "busybox",
+		"docker.io/library/busybox:latest":  "busybox:latest",
+		"docker.io/foo/bar":                 "foo/bar",
+		"docker.io/foo/bar:v1":              "foo/bar:v1",
+		"registry.example.com/foo/bar":      "registry.example.com/foo/bar",
+		"registry.example.com:5000/busybox": "registry.example.com:5000/busybox",
+		"localhost:5000/foo:latest":         "localhost:5000/foo:latest",
+	}
+	for name, expected := range testCases {
+		ref, err := reference.ParseNormalizedNamed(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shortened := ShortenForDisplay(ref); shortened != expected {
+			t.Errorf("expected %q to shorten to %q, got %q", name, expected, shortened)
+		}
+	}
+}
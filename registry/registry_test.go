@@ -905,6 +905,67 @@ func TestIsSecureIndex(t *testing.T) {
 	}
 }
 
+func TestServiceIsSecureIndex(t *testing.T) {
+	service, err := NewService(ServiceOptions{
+		InsecureRegistries: []string{"insecure.example.com", "42.42.0.0/16"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{IndexName, true},
+		{"secure.example.com", true},
+		{"insecure.example.com", false},
+		{"42.42.42.42:5000", false},
+	}
+	for _, tt := range tests {
+		if sec := service.IsSecureIndex(tt.addr); sec != tt.expected {
+			t.Errorf("IsSecureIndex(%q) = %v, expected %v", tt.addr, sec, tt.expected)
+		}
+	}
+}
+
+func TestResolveInsecure(t *testing.T) {
+	service, err := NewService(ServiceOptions{
+		InsecureRegistries: []string{"insecure.example.com", "42.42.0.0/16"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr     string
+		insecure bool
+		reason   SecureIndexReason
+	}{
+		{IndexName, false, SecureIndexReasonConfigured},
+		{"insecure.example.com", true, SecureIndexReasonConfigured},
+		{"42.42.42.42:5000", true, SecureIndexReasonCIDR},
+		{"secure.example.com", false, SecureIndexReasonDefault},
+	}
+	for _, tt := range tests {
+		insecure, reason := service.ResolveInsecure(tt.addr)
+		if insecure != tt.insecure || reason != tt.reason {
+			t.Errorf("ResolveInsecure(%q) = %v %q, expected %v %q",
+				tt.addr, insecure, reason, tt.insecure, tt.reason)
+		}
+	}
+
+	// Reloading the insecure list without the hostname removes its index
+	// entry, so the decision falls back to the secure default.
+	if err := service.LoadInsecureRegistries([]string{"42.42.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	insecure, reason := service.ResolveInsecure("insecure.example.com")
+	if insecure || reason != SecureIndexReasonDefault {
+		t.Errorf("expected insecure.example.com to fall back to the secure default, got %v %q", insecure, reason)
+	}
+}
+
 type debugTransport struct {
 	http.RoundTripper
 	log func(...interface{})
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"container/list"
+	"sync"
+)
+
+// repoInfoCacheSize bounds the number of parsed RepositoryInfo entries kept
+// per configuration. Bulk operations tend to revisit a small working set of
+// names, so a modest bound is enough to avoid repeated parsing without
+// letting the cache grow with every name ever seen.
+const repoInfoCacheSize = 256
+
+// repoInfoCache is a bounded LRU cache of RepositoryInfo keyed by the raw
+// repository name. It is safe for concurrent use.
+type repoInfoCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order tracks recency of use; the front element is the most recently
+	// used entry.
+	order *list.List
+}
+
+type repoInfoCacheEntry struct {
+	key  string
+	info *RepositoryInfo
+}
+
+func newRepoInfoCache() *repoInfoCache {
+	return &repoInfoCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns a copy of the cached RepositoryInfo for key, so callers cannot
+// mutate the cached value.
+func (c *repoInfoCache) get(key string) (*RepositoryInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	info := *element.Value.(*repoInfoCacheEntry).info
+	return &info, true
+}
+
+// add stores a copy of info under key, evicting the least recently used
+// entry if the cache is full.
+func (c *repoInfoCache) add(key string, info *RepositoryInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		element.Value.(*repoInfoCacheEntry).info = info
+		return
+	}
+	if c.order.Len() >= repoInfoCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*repoInfoCacheEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&repoInfoCacheEntry{key: key, info: info})
+}
+
+// clear drops all entries. It is called when the registry configuration is
+// reloaded, since index configuration feeds into RepositoryInfo.
+func (c *repoInfoCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+)
+
+func TestRepoInfoCacheReturnsCopies(t *testing.T) {
+	config, err := newServiceConfig(ServiceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := reference.ParseNormalizedNamed("busybox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := newRepositoryInfo(config, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Official = false
+
+	second, err := newRepositoryInfo(config, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatal("expected distinct RepositoryInfo values from the cache")
+	}
+	if !second.Official {
+		t.Fatal("mutating a returned RepositoryInfo must not affect the cache")
+	}
+}
+
+func TestRepoInfoCacheClearedOnReload(t *testing.T) {
+	config, err := newServiceConfig(ServiceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := reference.ParseNormalizedNamed("myregistry.example.com/busybox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := newRepositoryInfo(config, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Index.Secure {
+		t.Fatal("expected index to be secure before reload")
+	}
+
+	if err := config.LoadInsecureRegistries([]string{"myregistry.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = newRepositoryInfo(config, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Index.Secure {
+		t.Fatal("expected reload to invalidate the cached RepositoryInfo")
+	}
+}
+
+func TestRepoInfoCacheBounded(t *testing.T) {
+	cache := newRepoInfoCache()
+	for i := 0; i < repoInfoCacheSize+10; i++ {
+		cache.add(fmt.Sprintf("name-%d", i), &RepositoryInfo{})
+	}
+	if cache.order.Len() != repoInfoCacheSize {
+		t.Fatalf("expected cache to hold at most %d entries, got %d", repoInfoCacheSize, cache.order.Len())
+	}
+	if _, ok := cache.get("name-0"); ok {
+		t.Fatal("expected the least recently used entry to be evicted")
+	}
+}
+
+func BenchmarkParseRepositoryInfo(b *testing.B) {
+	name, err := reference.ParseNormalizedNamed("docker.io/library/busybox")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseRepositoryInfo(name); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
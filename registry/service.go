@@ -28,6 +28,11 @@ type Service interface {
 	Auth(ctx context.Context, authConfig *types.AuthConfig, userAgent string) (status, token string, err error)
 	LookupPullEndpoints(hostname string) (endpoints []APIEndpoint, err error)
 	LookupPushEndpoints(hostname string) (endpoints []APIEndpoint, err error)
+	IsIndexBlocked(indexName string) bool
+	IsIndexReadOnly(indexName string) bool
+	IsSecureIndex(indexName string) bool
+	RequiresPushConfirmation(indexName string) bool
+	RequiresFullyQualifiedNames() bool
 	ResolveRepository(name reference.Named) (*RepositoryInfo, error)
 	Search(ctx context.Context, term string, limit int, authConfig *types.AuthConfig, userAgent string, headers map[string][]string) (*registrytypes.SearchResults, error)
 	ServiceConfig() *registrytypes.ServiceConfig
@@ -104,6 +109,65 @@ func (s *DefaultService) LoadInsecureRegistries(registries []string) error {
 	return s.config.LoadInsecureRegistries(registries)
 }
 
+// IsIndexBlocked returns true if the daemon is configured to refuse contact
+// with the given index.
+func (s *DefaultService) IsIndexBlocked(indexName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config.isIndexBlocked(indexName)
+}
+
+// IsIndexReadOnly returns true if the given index may be pulled from but not
+// pushed to.
+func (s *DefaultService) IsIndexReadOnly(indexName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config.isIndexReadOnly(indexName)
+}
+
+// IsSecureIndex returns false if the given index is configured as insecure,
+// either explicitly or by matching an insecure CIDR. Callers can use it to
+// predict whether contacting the index will use verified TLS.
+func (s *DefaultService) IsSecureIndex(indexName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return isSecureIndex(s.config, indexName)
+}
+
+// ResolveInsecure reports whether the given index is considered insecure,
+// along with the reason for the decision: a configured IndexInfo, an
+// insecure-registry CIDR match, or the secure default. Per-index
+// configuration wins over CIDR matching, which can surprise when a stale
+// index entry shadows a CIDR; the reason lets callers explain that.
+func (s *DefaultService) ResolveInsecure(indexName string) (bool, SecureIndexReason) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secure, reason := resolveSecureIndex(s.config, indexName)
+	return !secure, reason
+}
+
+// RequiresPushConfirmation returns true if pushes to the given index must be
+// explicitly confirmed by the client.
+func (s *DefaultService) RequiresPushConfirmation(indexName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config.requiresPushConfirmation(indexName)
+}
+
+// RequiresFullyQualifiedNames returns true if the daemon is configured to
+// reject image references that do not explicitly name a registry.
+func (s *DefaultService) RequiresFullyQualifiedNames() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config.requireFullyQualifiedNames
+}
+
 // Auth contacts the public registry with the provided credentials,
 // and returns OK if authentication was successful.
 // It can be used to verify the validity of a client's credentials.